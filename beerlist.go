@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/tajtiattila/geocode"
@@ -47,6 +48,10 @@ type Pub struct {
 	Geo   LatLong
 	Tags  []string
 	Desc  []string
+
+	Hours *OpeningHours // nil if unknown
+
+	Visits []time.Time // dates from visit log tags
 }
 
 func (p Pub) Has(tag string) bool {
@@ -77,6 +82,9 @@ func (p Pub) WriteTo(w io.Writer) (n int, err error) {
 	if len(p.Tags) != 0 {
 		prt("%s\n", strings.Join(p.Tags, " "))
 	}
+	if p.Hours != nil {
+		prt("%s %s\n", hoursPrefix, p.Hours)
+	}
 	for _, d := range p.Desc {
 		prt("%s\n", d)
 	}
@@ -89,11 +97,30 @@ func (p Pub) IconBasename() string {
 	return fmt.Sprintf("icon-%s.png", p.Label)
 }
 
+// iconScales are the pixel ratios icons are rendered for.
+var iconScales = []int{1, 2, 3}
+
+// IconVariantBasename returns the file name of the icon
+// rendered for the pixel ratio scale.
+// The icon at scale 2 is the one named IconBasename.
+func (p Pub) IconVariantBasename(scale int) string {
+	if scale == 2 {
+		return p.IconBasename()
+	}
+	return fmt.Sprintf("icon-%s@%dx.png", p.Label, scale)
+}
+
+// IconSVGBasename returns the file name of the vector icon.
+func (p Pub) IconSVGBasename() string {
+	return fmt.Sprintf("icon-%s.svg", p.Label)
+}
+
 func parsePubList(r io.Reader, gc geocode.Geocoder, errh func(err error) error) ([]Pub, error) {
 	var pubs []Pub
 	seen := make(map[string]struct{})
 	err := parseMultiLine(r, func(lineno int, v []string) error {
-		var title, addr, tags string
+		var title, addr, tags, hours string
+		var hasHours bool
 		var rest []string
 		for _, line := range v {
 			if len(line) == 0 {
@@ -106,6 +133,11 @@ func parsePubList(r io.Reader, gc geocode.Geocoder, errh func(err error) error)
 				addr = line
 			case line[0] == '#':
 				tags += " " + line
+			case strings.HasPrefix(line, hoursPrefix):
+				if hasHours {
+					return errh(errors.Errorf("line %d: duplicate opening hours", lineno))
+				}
+				hours, hasHours = strings.TrimPrefix(line, hoursPrefix), true
 			default:
 				rest = append(rest, line)
 			}
@@ -115,7 +147,7 @@ func parsePubList(r io.Reader, gc geocode.Geocoder, errh func(err error) error)
 			return errh(errors.Errorf("line %d: missing title/addr", lineno))
 		}
 
-		p, err := parsePub(gc, title, addr, tags, rest)
+		p, err := parsePub(gc, title, addr, tags, hours, rest)
 		if err != nil {
 			return errh(errors.Wrapf(err, "line %d", lineno))
 		}
@@ -134,7 +166,10 @@ func parsePubList(r io.Reader, gc geocode.Geocoder, errh func(err error) error)
 	return pubs, err
 }
 
-func parsePub(gc geocode.Geocoder, title, addr, tags string, rest []string) (Pub, error) {
+// hoursPrefix starts the line with opening hours in OSM opening_hours syntax.
+const hoursPrefix = "hours:"
+
+func parsePub(gc geocode.Geocoder, title, addr, tags, hours string, rest []string) (Pub, error) {
 	var p Pub
 
 	i := strings.IndexRune(title, ']')
@@ -147,6 +182,22 @@ func parsePub(gc geocode.Geocoder, title, addr, tags string, rest []string) (Pub
 
 	p.Addr = strings.TrimSpace(strings.TrimRight(strings.TrimLeft(addr, "("), ")"))
 
+	p.Tags = strings.Fields(tags)
+	p.Desc = rest
+
+	var err error
+	p.Visits, err = parseVisits(p.Tags)
+	if err != nil {
+		return Pub{}, err
+	}
+
+	if strings.TrimSpace(hours) != "" {
+		p.Hours, err = ParseOpeningHours(hours)
+		if err != nil {
+			return Pub{}, err
+		}
+	}
+
 	r, err := gc.Geocode(p.Addr)
 	if err != nil {
 		return Pub{}, errors.Wrapf(err, "geocode failed for %q", p.Addr)
@@ -154,8 +205,5 @@ func parsePub(gc geocode.Geocoder, title, addr, tags string, rest []string) (Pub
 	p.Geo.Lat = r.Lat
 	p.Geo.Long = r.Long
 
-	p.Tags = strings.Fields(tags)
-	p.Desc = rest
-
 	return p, nil
 }
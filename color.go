@@ -0,0 +1,531 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func decodeOptionalColor(s string, def color.Color) (color.Color, error) {
+	if s == "" {
+		return def, nil
+	}
+	return decodeColor(s)
+}
+
+// decodeColor decodes a color spec. Accepted forms are
+//
+//	#rgb, #rgba, #rrggbb, #rrggbbaa
+//	rgb(r, g, b), rgba(r, g, b, a)
+//	hsl(h, s%, l%), hsla(h, s%, l%, a)
+//	CSS color names, eg. forestgreen
+//	lighten(c, 20%), darken(c, 20%)
+//	mix(a, b, t), alpha(c, 0.6)
+//
+// Functions may be nested, eg. alpha(darken(#228b22, 10%), 50%).
+func decodeColor(s string) (color.Color, error) {
+	c, err := parseColor(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid color spec %q", s)
+	}
+	return c, nil
+}
+
+func parseColor(s string) (color.NRGBA, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return color.NRGBA{}, errors.New("empty color spec")
+	}
+
+	if s[0] == '#' {
+		return parseHexColor(s[1:])
+	}
+
+	i := strings.IndexRune(s, '(')
+	if i < 0 {
+		c, ok := cssColors[strings.ToLower(s)]
+		if !ok {
+			return color.NRGBA{}, errors.Errorf("unknown color name %q", s)
+		}
+		return c, nil
+	}
+
+	if s[len(s)-1] != ')' {
+		return color.NRGBA{}, errors.New("missing closing parenthesis")
+	}
+	fn := strings.ToLower(strings.TrimSpace(s[:i]))
+	args, err := splitColorArgs(s[i+1 : len(s)-1])
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+
+	switch fn {
+	case "rgb", "rgba":
+		return parseRGBFunc(fn, args)
+	case "hsl", "hsla":
+		return parseHSLFunc(fn, args)
+	case "lighten", "darken":
+		if len(args) != 2 {
+			return color.NRGBA{}, errors.Errorf("%s needs 2 arguments", fn)
+		}
+		c, err := parseColor(args[0])
+		if err != nil {
+			return c, err
+		}
+		v, err := parseFraction(args[1])
+		if err != nil {
+			return c, err
+		}
+		if fn == "darken" {
+			v = -v
+		}
+		h, sat, l := rgbToHSL(c)
+		r := hslToRGB(h, sat, clamp01(l+v))
+		r.A = c.A
+		return r, nil
+	case "mix":
+		if len(args) != 3 {
+			return color.NRGBA{}, errors.New("mix needs 3 arguments")
+		}
+		a, err := parseColor(args[0])
+		if err != nil {
+			return a, err
+		}
+		b, err := parseColor(args[1])
+		if err != nil {
+			return b, err
+		}
+		t, err := parseFraction(args[2])
+		if err != nil {
+			return a, err
+		}
+		return lerpColor(a, b, t).(color.NRGBA), nil
+	case "alpha":
+		if len(args) != 2 {
+			return color.NRGBA{}, errors.New("alpha needs 2 arguments")
+		}
+		c, err := parseColor(args[0])
+		if err != nil {
+			return c, err
+		}
+		a, err := parseFraction(args[1])
+		if err != nil {
+			return c, err
+		}
+		c.A = unitByte(a)
+		return c, nil
+	}
+
+	return color.NRGBA{}, errors.Errorf("unknown color function %q", fn)
+}
+
+func parseHexColor(s string) (color.NRGBA, error) {
+	v, err := hexDigits(s)
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+
+	c := color.NRGBA{A: 0xff}
+	switch len(v) {
+	case 3, 4:
+		// eg #6f2
+		c.R = v[0] * 0x11
+		c.G = v[1] * 0x11
+		c.B = v[2] * 0x11
+		if len(v) == 4 {
+			c.A = v[3] * 0x11
+		}
+	case 6, 8:
+		// eg #66ff22
+		c.R = v[0]<<4 + v[1]
+		c.G = v[2]<<4 + v[3]
+		c.B = v[4]<<4 + v[5]
+		if len(v) == 8 {
+			c.A = v[6]<<4 + v[7]
+		}
+	default:
+		return c, errors.New("invalid number of hex digits")
+	}
+	return c, nil
+}
+
+func parseRGBFunc(fn string, args []string) (color.NRGBA, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return color.NRGBA{}, errors.Errorf("%s needs 3 or 4 arguments", fn)
+	}
+	var v [3]uint8
+	for i := range v {
+		x, err := parseChannel(args[i])
+		if err != nil {
+			return color.NRGBA{}, err
+		}
+		v[i] = x
+	}
+	c := color.NRGBA{v[0], v[1], v[2], 0xff}
+	if len(args) == 4 {
+		a, err := parseFraction(args[3])
+		if err != nil {
+			return c, err
+		}
+		c.A = unitByte(a)
+	}
+	return c, nil
+}
+
+func parseHSLFunc(fn string, args []string) (color.NRGBA, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return color.NRGBA{}, errors.Errorf("%s needs 3 or 4 arguments", fn)
+	}
+	h, err := strconv.ParseFloat(strings.TrimSuffix(args[0], "deg"), 64)
+	if err != nil {
+		return color.NRGBA{}, errors.Errorf("invalid hue %q", args[0])
+	}
+	var sl [2]float64
+	for i := range sl {
+		a := args[i+1]
+		if !strings.HasSuffix(a, "%") {
+			return color.NRGBA{}, errors.Errorf("%s needs percentage, got %q", fn, a)
+		}
+		sl[i], err = parseFraction(a)
+		if err != nil {
+			return color.NRGBA{}, err
+		}
+	}
+	c := hslToRGB(h, sl[0], sl[1])
+	if len(args) == 4 {
+		a, err := parseFraction(args[3])
+		if err != nil {
+			return c, err
+		}
+		c.A = unitByte(a)
+	}
+	return c, nil
+}
+
+// splitColorArgs splits s at commas outside parentheses.
+func splitColorArgs(s string) ([]string, error) {
+	var args []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses")
+	}
+	args = append(args, strings.TrimSpace(s[start:]))
+	for _, a := range args {
+		if a == "" {
+			return nil, errors.New("empty argument")
+		}
+	}
+	return args, nil
+}
+
+// parseChannel parses a color channel in range 0-255 or 0%-100%.
+func parseChannel(s string) (uint8, error) {
+	if strings.HasSuffix(s, "%") {
+		v, err := parseFraction(s)
+		return unitByte(v), err
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || v > 255 {
+		return 0, errors.Errorf("invalid color channel %q", s)
+	}
+	return uint8(v + 0.5), nil
+}
+
+// parseFraction parses a fraction in range 0-1 or 0%-100%.
+func parseFraction(s string) (float64, error) {
+	p := strings.HasSuffix(s, "%")
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid number %q", s)
+	}
+	if p {
+		v /= 100
+	}
+	if v < 0 || v > 1 {
+		return 0, errors.Errorf("%q out of range", s)
+	}
+	return v, nil
+}
+
+// lerpColor interpolates linearly between a and b,
+// f is clamped to [0, 1].
+func lerpColor(a, b color.Color, f float64) color.Color {
+	f = clamp01(f)
+	ca := color.NRGBAModel.Convert(a).(color.NRGBA)
+	cb := color.NRGBAModel.Convert(b).(color.NRGBA)
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*f + 0.5)
+	}
+	return color.NRGBA{
+		R: mix(ca.R, cb.R),
+		G: mix(ca.G, cb.G),
+		B: mix(ca.B, cb.B),
+		A: mix(ca.A, cb.A),
+	}
+}
+
+func unitByte(v float64) uint8 {
+	return uint8(clamp01(v)*255 + 0.5)
+}
+
+func clamp01(v float64) float64 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 1:
+		return 1
+	}
+	return v
+}
+
+func hexDigits(s string) ([]byte, error) {
+	var v []byte
+	for _, r := range s {
+		switch {
+		case '0' <= r && r <= '9':
+			v = append(v, byte(r-'0'))
+		case 'a' <= r && r <= 'f':
+			v = append(v, byte(r-'a'+10))
+		case 'A' <= r && r <= 'F':
+			v = append(v, byte(r-'A'+10))
+		default:
+			return nil, errors.Errorf("invalid hex digit %q", r)
+		}
+	}
+	return v, nil
+}
+
+// rgbToHSL returns hue in degrees, saturation and lightness in range 0-1.
+func rgbToHSL(c color.NRGBA) (h, s, l float64) {
+	r := float64(c.R) / 255
+	g := float64(c.G) / 255
+	b := float64(c.B) / 255
+
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	l = (max + min) / 2
+	if max == min {
+		return 0, 0, l
+	}
+
+	d := max - min
+	if l > 0.5 {
+		s = d / (2 - max - min)
+	} else {
+		s = d / (max + min)
+	}
+
+	switch max {
+	case r:
+		h = (g - b) / d
+		if g < b {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h * 60, s, l
+}
+
+// hslToRGB converts hue in degrees, saturation and lightness to an opaque color.
+func hslToRGB(h, s, l float64) color.NRGBA {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return color.NRGBA{unitByte(r + m), unitByte(g + m), unitByte(b + m), 0xff}
+}
+
+// cssColors holds the CSS named colors.
+var cssColors = map[string]color.NRGBA{
+	"transparent":          {0x00, 0x00, 0x00, 0x00},
+	"aliceblue":            {0xf0, 0xf8, 0xff, 0xff},
+	"antiquewhite":         {0xfa, 0xeb, 0xd7, 0xff},
+	"aqua":                 {0x00, 0xff, 0xff, 0xff},
+	"aquamarine":           {0x7f, 0xff, 0xd4, 0xff},
+	"azure":                {0xf0, 0xff, 0xff, 0xff},
+	"beige":                {0xf5, 0xf5, 0xdc, 0xff},
+	"bisque":               {0xff, 0xe4, 0xc4, 0xff},
+	"black":                {0x00, 0x00, 0x00, 0xff},
+	"blanchedalmond":       {0xff, 0xeb, 0xcd, 0xff},
+	"blue":                 {0x00, 0x00, 0xff, 0xff},
+	"blueviolet":           {0x8a, 0x2b, 0xe2, 0xff},
+	"brown":                {0xa5, 0x2a, 0x2a, 0xff},
+	"burlywood":            {0xde, 0xb8, 0x87, 0xff},
+	"cadetblue":            {0x5f, 0x9e, 0xa0, 0xff},
+	"chartreuse":           {0x7f, 0xff, 0x00, 0xff},
+	"chocolate":            {0xd2, 0x69, 0x1e, 0xff},
+	"coral":                {0xff, 0x7f, 0x50, 0xff},
+	"cornflowerblue":       {0x64, 0x95, 0xed, 0xff},
+	"cornsilk":             {0xff, 0xf8, 0xdc, 0xff},
+	"crimson":              {0xdc, 0x14, 0x3c, 0xff},
+	"cyan":                 {0x00, 0xff, 0xff, 0xff},
+	"darkblue":             {0x00, 0x00, 0x8b, 0xff},
+	"darkcyan":             {0x00, 0x8b, 0x8b, 0xff},
+	"darkgoldenrod":        {0xb8, 0x86, 0x0b, 0xff},
+	"darkgray":             {0xa9, 0xa9, 0xa9, 0xff},
+	"darkgreen":            {0x00, 0x64, 0x00, 0xff},
+	"darkgrey":             {0xa9, 0xa9, 0xa9, 0xff},
+	"darkkhaki":            {0xbd, 0xb7, 0x6b, 0xff},
+	"darkmagenta":          {0x8b, 0x00, 0x8b, 0xff},
+	"darkolivegreen":       {0x55, 0x6b, 0x2f, 0xff},
+	"darkorange":           {0xff, 0x8c, 0x00, 0xff},
+	"darkorchid":           {0x99, 0x32, 0xcc, 0xff},
+	"darkred":              {0x8b, 0x00, 0x00, 0xff},
+	"darksalmon":           {0xe9, 0x96, 0x7a, 0xff},
+	"darkseagreen":         {0x8f, 0xbc, 0x8f, 0xff},
+	"darkslateblue":        {0x48, 0x3d, 0x8b, 0xff},
+	"darkslategray":        {0x2f, 0x4f, 0x4f, 0xff},
+	"darkslategrey":        {0x2f, 0x4f, 0x4f, 0xff},
+	"darkturquoise":        {0x00, 0xce, 0xd1, 0xff},
+	"darkviolet":           {0x94, 0x00, 0xd3, 0xff},
+	"deeppink":             {0xff, 0x14, 0x93, 0xff},
+	"deepskyblue":          {0x00, 0xbf, 0xff, 0xff},
+	"dimgray":              {0x69, 0x69, 0x69, 0xff},
+	"dimgrey":              {0x69, 0x69, 0x69, 0xff},
+	"dodgerblue":           {0x1e, 0x90, 0xff, 0xff},
+	"firebrick":            {0xb2, 0x22, 0x22, 0xff},
+	"floralwhite":          {0xff, 0xfa, 0xf0, 0xff},
+	"forestgreen":          {0x22, 0x8b, 0x22, 0xff},
+	"fuchsia":              {0xff, 0x00, 0xff, 0xff},
+	"gainsboro":            {0xdc, 0xdc, 0xdc, 0xff},
+	"ghostwhite":           {0xf8, 0xf8, 0xff, 0xff},
+	"gold":                 {0xff, 0xd7, 0x00, 0xff},
+	"goldenrod":            {0xda, 0xa5, 0x20, 0xff},
+	"gray":                 {0x80, 0x80, 0x80, 0xff},
+	"green":                {0x00, 0x80, 0x00, 0xff},
+	"greenyellow":          {0xad, 0xff, 0x2f, 0xff},
+	"grey":                 {0x80, 0x80, 0x80, 0xff},
+	"honeydew":             {0xf0, 0xff, 0xf0, 0xff},
+	"hotpink":              {0xff, 0x69, 0xb4, 0xff},
+	"indianred":            {0xcd, 0x5c, 0x5c, 0xff},
+	"indigo":               {0x4b, 0x00, 0x82, 0xff},
+	"ivory":                {0xff, 0xff, 0xf0, 0xff},
+	"khaki":                {0xf0, 0xe6, 0x8c, 0xff},
+	"lavender":             {0xe6, 0xe6, 0xfa, 0xff},
+	"lavenderblush":        {0xff, 0xf0, 0xf5, 0xff},
+	"lawngreen":            {0x7c, 0xfc, 0x00, 0xff},
+	"lemonchiffon":         {0xff, 0xfa, 0xcd, 0xff},
+	"lightblue":            {0xad, 0xd8, 0xe6, 0xff},
+	"lightcoral":           {0xf0, 0x80, 0x80, 0xff},
+	"lightcyan":            {0xe0, 0xff, 0xff, 0xff},
+	"lightgoldenrodyellow": {0xfa, 0xfa, 0xd2, 0xff},
+	"lightgray":            {0xd3, 0xd3, 0xd3, 0xff},
+	"lightgreen":           {0x90, 0xee, 0x90, 0xff},
+	"lightgrey":            {0xd3, 0xd3, 0xd3, 0xff},
+	"lightpink":            {0xff, 0xb6, 0xc1, 0xff},
+	"lightsalmon":          {0xff, 0xa0, 0x7a, 0xff},
+	"lightseagreen":        {0x20, 0xb2, 0xaa, 0xff},
+	"lightskyblue":         {0x87, 0xce, 0xfa, 0xff},
+	"lightslategray":       {0x77, 0x88, 0x99, 0xff},
+	"lightslategrey":       {0x77, 0x88, 0x99, 0xff},
+	"lightsteelblue":       {0xb0, 0xc4, 0xde, 0xff},
+	"lightyellow":          {0xff, 0xff, 0xe0, 0xff},
+	"lime":                 {0x00, 0xff, 0x00, 0xff},
+	"limegreen":            {0x32, 0xcd, 0x32, 0xff},
+	"linen":                {0xfa, 0xf0, 0xe6, 0xff},
+	"magenta":              {0xff, 0x00, 0xff, 0xff},
+	"maroon":               {0x80, 0x00, 0x00, 0xff},
+	"mediumaquamarine":     {0x66, 0xcd, 0xaa, 0xff},
+	"mediumblue":           {0x00, 0x00, 0xcd, 0xff},
+	"mediumorchid":         {0xba, 0x55, 0xd3, 0xff},
+	"mediumpurple":         {0x93, 0x70, 0xdb, 0xff},
+	"mediumseagreen":       {0x3c, 0xb3, 0x71, 0xff},
+	"mediumslateblue":      {0x7b, 0x68, 0xee, 0xff},
+	"mediumspringgreen":    {0x00, 0xfa, 0x9a, 0xff},
+	"mediumturquoise":      {0x48, 0xd1, 0xcc, 0xff},
+	"mediumvioletred":      {0xc7, 0x15, 0x85, 0xff},
+	"midnightblue":         {0x19, 0x19, 0x70, 0xff},
+	"mintcream":            {0xf5, 0xff, 0xfa, 0xff},
+	"mistyrose":            {0xff, 0xe4, 0xe1, 0xff},
+	"moccasin":             {0xff, 0xe4, 0xb5, 0xff},
+	"navajowhite":          {0xff, 0xde, 0xad, 0xff},
+	"navy":                 {0x00, 0x00, 0x80, 0xff},
+	"oldlace":              {0xfd, 0xf5, 0xe6, 0xff},
+	"olive":                {0x80, 0x80, 0x00, 0xff},
+	"olivedrab":            {0x6b, 0x8e, 0x23, 0xff},
+	"orange":               {0xff, 0xa5, 0x00, 0xff},
+	"orangered":            {0xff, 0x45, 0x00, 0xff},
+	"orchid":               {0xda, 0x70, 0xd6, 0xff},
+	"palegoldenrod":        {0xee, 0xe8, 0xaa, 0xff},
+	"palegreen":            {0x98, 0xfb, 0x98, 0xff},
+	"paleturquoise":        {0xaf, 0xee, 0xee, 0xff},
+	"palevioletred":        {0xdb, 0x70, 0x93, 0xff},
+	"papayawhip":           {0xff, 0xef, 0xd5, 0xff},
+	"peachpuff":            {0xff, 0xda, 0xb9, 0xff},
+	"peru":                 {0xcd, 0x85, 0x3f, 0xff},
+	"pink":                 {0xff, 0xc0, 0xcb, 0xff},
+	"plum":                 {0xdd, 0xa0, 0xdd, 0xff},
+	"powderblue":           {0xb0, 0xe0, 0xe6, 0xff},
+	"purple":               {0x80, 0x00, 0x80, 0xff},
+	"rebeccapurple":        {0x66, 0x33, 0x99, 0xff},
+	"red":                  {0xff, 0x00, 0x00, 0xff},
+	"rosybrown":            {0xbc, 0x8f, 0x8f, 0xff},
+	"royalblue":            {0x41, 0x69, 0xe1, 0xff},
+	"saddlebrown":          {0x8b, 0x45, 0x13, 0xff},
+	"salmon":               {0xfa, 0x80, 0x72, 0xff},
+	"sandybrown":           {0xf4, 0xa4, 0x60, 0xff},
+	"seagreen":             {0x2e, 0x8b, 0x57, 0xff},
+	"seashell":             {0xff, 0xf5, 0xee, 0xff},
+	"sienna":               {0xa0, 0x52, 0x2d, 0xff},
+	"silver":               {0xc0, 0xc0, 0xc0, 0xff},
+	"skyblue":              {0x87, 0xce, 0xeb, 0xff},
+	"slateblue":            {0x6a, 0x5a, 0xcd, 0xff},
+	"slategray":            {0x70, 0x80, 0x90, 0xff},
+	"slategrey":            {0x70, 0x80, 0x90, 0xff},
+	"snow":                 {0xff, 0xfa, 0xfa, 0xff},
+	"springgreen":          {0x00, 0xff, 0x7f, 0xff},
+	"steelblue":            {0x46, 0x82, 0xb4, 0xff},
+	"tan":                  {0xd2, 0xb4, 0x8c, 0xff},
+	"teal":                 {0x00, 0x80, 0x80, 0xff},
+	"thistle":              {0xd8, 0xbf, 0xd8, 0xff},
+	"tomato":               {0xff, 0x63, 0x47, 0xff},
+	"turquoise":            {0x40, 0xe0, 0xd0, 0xff},
+	"violet":               {0xee, 0x82, 0xee, 0xff},
+	"wheat":                {0xf5, 0xde, 0xb3, 0xff},
+	"white":                {0xff, 0xff, 0xff, 0xff},
+	"whitesmoke":           {0xf5, 0xf5, 0xf5, 0xff},
+	"yellow":               {0xff, 0xff, 0x00, 0xff},
+	"yellowgreen":          {0x9a, 0xcd, 0x32, 0xff},
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestDecodeColor(t *testing.T) {
+	tests := []struct {
+		src  string
+		want color.NRGBA
+	}{
+		{"#6f2", color.NRGBA{0x66, 0xff, 0x22, 0xff}},
+		{"#66ff22", color.NRGBA{0x66, 0xff, 0x22, 0xff}},
+		{"#66ff2280", color.NRGBA{0x66, 0xff, 0x22, 0x80}},
+		{"#6f28", color.NRGBA{0x66, 0xff, 0x22, 0x88}},
+		{"ForestGreen", color.NRGBA{0x22, 0x8b, 0x22, 0xff}},
+		{"transparent", color.NRGBA{0, 0, 0, 0}},
+		{"rgb(34, 139, 34)", color.NRGBA{0x22, 0x8b, 0x22, 0xff}},
+		{"rgba(34, 139, 34, 0.5)", color.NRGBA{0x22, 0x8b, 0x22, 0x80}},
+		{"rgb(100%, 0%, 50%)", color.NRGBA{0xff, 0x00, 0x80, 0xff}},
+		{"hsl(120, 100%, 25%)", color.NRGBA{0x00, 0x80, 0x00, 0xff}},
+		{"hsla(0deg, 100%, 50%, 50%)", color.NRGBA{0xff, 0x00, 0x00, 0x80}},
+		{"lighten(#000, 50%)", color.NRGBA{0x80, 0x80, 0x80, 0xff}},
+		{"darken(white, 100%)", color.NRGBA{0, 0, 0, 0xff}},
+		{"darken(hsl(120, 100%, 50%), 25%)", color.NRGBA{0x00, 0x80, 0x00, 0xff}},
+		{"mix(black, white, 0.25)", color.NRGBA{0x40, 0x40, 0x40, 0xff}},
+		{"alpha(#228b22, 0.6)", color.NRGBA{0x22, 0x8b, 0x22, 0x99}},
+		{"alpha(mix(red, blue, 50%), 0)", color.NRGBA{0x80, 0x00, 0x80, 0x00}},
+	}
+
+	for _, x := range tests {
+		c, err := decodeColor(x.src)
+		if err != nil {
+			t.Errorf("%s: %v", x.src, err)
+			continue
+		}
+		if got := c.(color.NRGBA); got != x.want {
+			t.Errorf("%s got %v, want %v", x.src, got, x.want)
+		}
+	}
+}
+
+func TestDecodeColorErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"#12",
+		"#12345",
+		"#ggg",
+		"notacolor",
+		"rgb(1, 2)",
+		"rgb(1, 2, 256)",
+		"rgba(1, 2, 3, 2)",
+		"hsl(120, 100, 50%)",
+		"lighten(#000)",
+		"mix(red, blue)",
+		"alpha(red, 0.5",
+		"alpha(red,, 0.5)",
+		"rgb(1, 2, 3))",
+		"shade(red, 10%)",
+	}
+
+	for _, src := range tests {
+		if _, err := decodeColor(src); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+}
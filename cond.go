@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -11,7 +13,9 @@ type Cond interface {
 	Accept(p Pub) bool
 }
 
-func decodeCond(i interface{}) (Cond, error) {
+// decodeCond decodes a condition from its JSON representation
+// within env, which may be nil.
+func decodeCond(i interface{}, env *condEnv) (Cond, error) {
 	switch x := i.(type) {
 
 	case nil:
@@ -21,12 +25,33 @@ func decodeCond(i interface{}) (Cond, error) {
 		return decodeCondMap(x)
 
 	case string:
-		return decodeCondString(x)
+		return decodeCondStringEnv(x, env)
 	}
 
 	return nil, fmt.Errorf("Unknown condition type %T", i)
 }
 
+// condSpecificity returns the number of predicates c tests,
+// counting only the most specific alternative of OR conditions.
+// Like with CSS selectors, more specific styles override others in cascade mode.
+func condSpecificity(c Cond) int {
+	switch c := c.(type) {
+	case nil, *trueCond:
+		return 0
+	case *notCond:
+		return condSpecificity(c.n)
+	case *andCond:
+		return condSpecificity(c.a) + condSpecificity(c.b)
+	case *orCond:
+		a, b := condSpecificity(c.a), condSpecificity(c.b)
+		if b > a {
+			return b
+		}
+		return a
+	}
+	return 1
+}
+
 type trueCond struct{}
 
 func (*trueCond) Accept(Pub) bool {
@@ -64,13 +89,22 @@ func decodeCondMap(m map[string]interface{}) (Cond, error) {
 }
 
 func decodeCondString(s string) (Cond, error) {
-	t := condTok{src: s}
+	return decodeCondStringEnv(s, nil)
+}
+
+func decodeCondStringEnv(s string, env *condEnv) (Cond, error) {
+	t := condTok{src: s, env: env}
 	c, err := decodeCondExpr(&t)
 	if err == nil && !t.done() {
 		err = errors.New("garbage after expression")
 	}
 
 	if err != nil {
+		var me condMacroError
+		if errors.As(err, &me) {
+			// error within named condition, position is meaningless here
+			return nil, err
+		}
 		return nil, fmt.Errorf("Parse condition at %d: %w", t.pos, err)
 	}
 
@@ -138,11 +172,52 @@ func decodeCondArg(t *condTok) (Cond, error) {
 
 	case len(tok) > 1 && tok[0] == '#':
 		return &hasTagCond{tok}, nil
+
+	case len(tok) > 1 && tok[0] == '@':
+		if t.env == nil {
+			return nil, errors.Errorf("unknown condition %s", tok)
+		}
+		return t.env.get(tok[1:])
+
+	case tok == "open_at":
+		arg, err := decodeCondStringArg(t)
+		if err != nil {
+			return nil, err
+		}
+		day, m, err := parseWeekTime(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &openAtCond{day, m}, nil
+
+	case tok == "open_now":
+		return &openNowCond{t.env.location(), t.env.clock()}, nil
+
+	case tok == "last_visit":
+		return decodeLastVisitCond(t)
+
+	case strings.HasPrefix(tok, "visits"):
+		return decodeVisitCountCond(t, strings.TrimPrefix(tok, "visits"))
 	}
 
 	return nil, errors.New("invalid expression")
 }
 
+// decodeCondStringArg decodes a parenthesized string literal argument.
+func decodeCondStringArg(t *condTok) (string, error) {
+	if t.next() != "(" {
+		return "", errors.New("missing argument")
+	}
+	arg := t.next()
+	if len(arg) < 2 || arg[0] != '"' || arg[len(arg)-1] != '"' {
+		return "", errors.New("invalid string argument")
+	}
+	if t.next() != ")" {
+		return "", errors.New("unclosed argument list")
+	}
+	return arg[1 : len(arg)-1], nil
+}
+
 // notCond is Cond representing a logical NOT condition
 type notCond struct {
 	n Cond
@@ -170,12 +245,34 @@ func (c *orCond) Accept(p Pub) bool {
 	return c.a.Accept(p) || c.b.Accept(p)
 }
 
+// openAtCond is Cond accepting pubs open at a weekday and time
+type openAtCond struct {
+	day    time.Weekday
+	minute int
+}
+
+func (c *openAtCond) Accept(p Pub) bool {
+	return p.Hours != nil && p.Hours.openAt(c.day, c.minute)
+}
+
+// openNowCond is Cond accepting pubs open at the time of evaluation
+type openNowCond struct {
+	loc *time.Location
+	now func() time.Time
+}
+
+func (c *openNowCond) Accept(p Pub) bool {
+	return p.Hours != nil && p.Hours.OpenAt(c.now().In(c.loc))
+}
+
 // condTok is the condition tokenizer
 type condTok struct {
 	src string
 	pos int
 
 	back string // used to yield last token again
+
+	env *condEnv // may be nil
 }
 
 func (t *condTok) done() bool {
@@ -207,6 +304,14 @@ func (t *condTok) next() string {
 		return "and"
 	case '|':
 		return "or"
+	case '"':
+		for !t.done() && t.src[t.pos] != '"' {
+			t.pos++
+		}
+		if !t.done() {
+			t.pos++
+		}
+		return t.src[start:t.pos]
 	}
 
 	for !t.done() && !istoksep(t.src[t.pos]) {
@@ -223,9 +328,126 @@ func (t *condTok) skipSpace() {
 }
 
 func istoksep(b byte) bool {
-	return isspace(b) || strings.IndexByte("()!&|", b) >= 0
+	return isspace(b) || strings.IndexByte("()!&|\"", b) >= 0
 }
 
 func isspace(b byte) bool {
 	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
 }
+
+// condEnv is the environment conditions are decoded in.
+type condEnv struct {
+	// named conditions that may be referenced as @name
+	src  map[string]interface{}
+	cond map[string]Cond
+
+	stack []string // names being decoded, used to detect cycles
+
+	// loc is the time zone used by open_now, nil means local time.
+	loc *time.Location
+
+	// now returns the current time for open_now, nil means time.Now.
+	now func() time.Time
+}
+
+// newCondEnv decodes all named conditions in src.
+// It reports unknown references and cycles even
+// for conditions not used by any style.
+func newCondEnv(src map[string]interface{}, loc *time.Location) (*condEnv, error) {
+	m := &condEnv{
+		src:  src,
+		cond: make(map[string]Cond),
+		loc:  loc,
+	}
+	// sorted, so the same error is reported on each run
+	names := make([]string, 0, len(src))
+	for name := range src {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !validCondName(name) {
+			return nil, errors.Errorf("invalid condition name %q", name)
+		}
+	}
+	for _, name := range names {
+		if _, err := m.get(name); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *condEnv) get(name string) (Cond, error) {
+	if c, ok := m.cond[name]; ok {
+		return c, nil
+	}
+
+	for i, n := range m.stack {
+		if n == name {
+			cycle := append(append([]string(nil), m.stack[i:]...), name)
+			return nil, errors.Errorf("condition cycle @%s", strings.Join(cycle, " -> @"))
+		}
+	}
+
+	src, ok := m.src[name]
+	if !ok {
+		return nil, errors.Errorf("unknown condition @%s", name)
+	}
+
+	m.stack = append(m.stack, name)
+	c, err := decodeCond(src, m)
+	m.stack = m.stack[:len(m.stack)-1]
+	if err != nil {
+		var me condMacroError
+		if errors.As(err, &me) {
+			return nil, err
+		}
+		return nil, condMacroError{name, err}
+	}
+
+	m.cond[name] = c
+	return c, nil
+}
+
+func (m *condEnv) location() *time.Location {
+	if m == nil || m.loc == nil {
+		return time.Local
+	}
+	return m.loc
+}
+
+func (m *condEnv) clock() func() time.Time {
+	if m == nil || m.now == nil {
+		return time.Now
+	}
+	return m.now
+}
+
+// condMacroError reports an error within a named condition.
+// Conditions referencing it pass it through unchanged,
+// so the message names the innermost condition only once.
+type condMacroError struct {
+	name string
+	err  error
+}
+
+func (e condMacroError) Error() string {
+	return fmt.Sprintf("condition @%s: %v", e.name, e.err)
+}
+
+func (e condMacroError) Unwrap() error {
+	return e.err
+}
+
+func validCondName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if istoksep(name[i]) || name[i] == '#' || name[i] == '@' {
+			return false
+		}
+	}
+	return true
+}
@@ -86,3 +86,82 @@ func TestCond(t *testing.T) {
 		}
 	}
 }
+
+func TestCondMacros(t *testing.T) {
+	macros, err := newCondEnv(map[string]interface{}{
+		"visited": "#2016 or #2018",
+		"open":    "not #closed",
+		"good":    "@visited and @open",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubs := []Pub{
+		{Label: "a", Tags: []string{"#2016"}},
+		{Label: "b", Tags: []string{"#2018", "#closed"}},
+		{Label: "c", Tags: []string{"#hotel"}},
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"@visited", "ab"},
+		{"@good", "a"},
+		{"not @good", "bc"},
+		{"@open and not @visited", "c"},
+	}
+
+	for _, x := range tests {
+		cond, err := decodeCondStringEnv(x.src, macros)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got string
+		for _, p := range pubs {
+			if cond.Accept(p) {
+				got += p.Label
+			}
+		}
+
+		if got != x.want {
+			t.Errorf("%s accept got %v, want %v", x.src, got, x.want)
+		}
+	}
+}
+
+func TestCondMacroErrors(t *testing.T) {
+	tests := []struct {
+		src  map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"a": "@a"}, "condition @a: Parse condition at 2: condition cycle @a -> @a"},
+		{map[string]interface{}{"a": "@b", "b": "#x or @a"}, "condition @b: Parse condition at 8: condition cycle @a -> @b -> @a"},
+		{map[string]interface{}{"a": "@missing"}, "condition @a: Parse condition at 8: unknown condition @missing"},
+		{map[string]interface{}{"a": "#x and"}, "condition @a: Parse condition at 6: invalid expression"},
+		{map[string]interface{}{"bad name": "#x"}, "invalid condition name \"bad name\""},
+		{map[string]interface{}{"c": "#x and", "b": "@missing", "a": "@c"}, "condition @c: Parse condition at 6: invalid expression"},
+		{map[string]interface{}{"z z": "#x", "y y": "#x"}, "invalid condition name \"y y\""},
+	}
+
+	for _, tt := range tests {
+		// map order is random, so repeat to catch unstable errors
+		for i := 0; i < 10; i++ {
+			_, err := newCondEnv(tt.src, nil)
+			if err == nil {
+				t.Errorf("%v: want error", tt.src)
+				break
+			}
+			if err.Error() != tt.want {
+				t.Errorf("%v: got error %q, want %q", tt.src, err, tt.want)
+				break
+			}
+		}
+	}
+
+	if _, err := decodeCondString("@visited"); err == nil {
+		t.Error("@visited without macros: want error")
+	}
+}
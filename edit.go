@@ -5,13 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"io/ioutil"
+	"image"
 	"log"
 	"net/http"
 	"net/url"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -29,23 +31,24 @@ type editor struct {
 	// gc is used to look up addresses
 	gc geocode.Geocoder
 
-	// fontSrc retursn raw TTF fonts
-	fontSrc func(fontname string) ([]byte, error)
+	// fontSrc returns raw TTF fonts available to all maps
+	fontSrc FontSource
 
 	defaultIconRenderer *icon.Renderer
 
+	// commitMu serializes committing saves and sweeping unused icon blobs
+	commitMu sync.Mutex
+
 	base http.Handler
 }
 
 func newEditor(prefix, resdir string, mdb *mapDB, gc geocode.Geocoder) *editor {
 	return &editor{
-		prefix: prefix,
-		resdir: resdir,
-		mdb:    mdb,
-		gc:     gc,
-		fontSrc: func(fn string) ([]byte, error) {
-			return ioutil.ReadFile(filepath.Join("res", fn))
-		},
+		prefix:  prefix,
+		resdir:  resdir,
+		mdb:     mdb,
+		gc:      gc,
+		fontSrc: fontDir("res"),
 
 		base: http.FileServer(http.Dir(resdir)),
 	}
@@ -96,6 +99,12 @@ func (e *editor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 		e.serveEdit(w, req, mm, t)
+	case "/preview":
+		if !e.authorized(req, mm) {
+			httpErrorCode(w, http.StatusForbidden)
+			return
+		}
+		e.servePreview(w, req, mm)
 	default:
 		e.base.ServeHTTP(w, requestWithPath(req, sub))
 	}
@@ -139,21 +148,28 @@ func (e *editor) serveNew(w http.ResponseWriter, req *http.Request) {
 	httpRedirect(w, req, u, http.StatusTemporaryRedirect)
 }
 
-func (e *editor) serveEdit(w http.ResponseWriter, req *http.Request, mm mapMeta, t *template.Template) {
-	if req.Method != "POST" && req.Method != "GET" {
-		httpErrorCode(w, http.StatusBadRequest)
-		return
-	}
-
+// authorized reports if req has the edit password of mm.
+func (e *editor) authorized(req *http.Request, mm mapMeta) bool {
 	editPass := req.URL.Query().Get(editPassName)
 	if !editPassGen.validKey(editPass) {
 		log.Printf("invalid editPass")
-		httpErrorCode(w, http.StatusForbidden)
-		return
+		return false
 	}
 
 	if mm.EditPass != editPass {
 		log.Printf("unauthorized editpass for %q: %v != %v", mm.Key, editPass, mm.EditPass)
+		return false
+	}
+	return true
+}
+
+func (e *editor) serveEdit(w http.ResponseWriter, req *http.Request, mm mapMeta, t *template.Template) {
+	if req.Method != "POST" && req.Method != "GET" {
+		httpErrorCode(w, http.StatusBadRequest)
+		return
+	}
+
+	if !e.authorized(req, mm) {
 		httpErrorCode(w, http.StatusForbidden)
 		return
 	}
@@ -212,6 +228,10 @@ func (e *editor) handlePost(mm *mapMeta, errh func(error), req *http.Request) {
 		switch formName {
 		case "listtxt", "iconstyle", "mapstyle":
 			return 1 << 20, 0
+		case "fonts":
+			return 8 << 20, 32 << 20
+		case "images":
+			return 1 << 20, 8 << 20
 		}
 		return 0, 0
 	})
@@ -227,7 +247,9 @@ func (e *editor) handlePost(mm *mapMeta, errh func(error), req *http.Request) {
 	}
 
 	batch := e.mdb.db.Batch()
-	e.handleUIMapSave(mm, batch, form, errh)
+	cache := newIconCache(e.mdb.db, batch)
+	res := e.handleResourceUpload(mm, batch, form, errh)
+	e.handleUIMapSave(mm, batch, cache, form, res, errh)
 
 	if f, ok := form.File("mapstyle"); ok {
 		var l []interface{}
@@ -246,16 +268,83 @@ func (e *editor) handlePost(mm *mapMeta, errh func(error), req *http.Request) {
 	}
 	batch.Set("meta|"+mm.Key, p)
 
-	if err := batch.Commit(); err != nil {
+	if err := e.commit(batch, cache); err != nil {
 		errh(errors.Wrap(err, "map save error"))
 	}
 }
 
-func (e *editor) handleUIMapSave(mm *mapMeta, batch keyvalue.Batch, form *multipartForm, errh func(error)) {
+// commit commits batch with the icons of cache.
+func (e *editor) commit(batch keyvalue.Batch, cache *iconCache) error {
+	e.commitMu.Lock()
+	defer e.commitMu.Unlock()
+	if err := cache.restore(); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
+
+// sweepBlobs deletes icon blobs not used by any map.
+func (e *editor) sweepBlobs() (deleted int, err error) {
+	e.commitMu.Lock()
+	defer e.commitMu.Unlock()
+	return sweepBlobs(e.mdb.db)
+}
+
+// sweepBlobsEvery runs sweepBlobs periodically.
+func (e *editor) sweepBlobsEvery(d time.Duration) {
+	for range time.Tick(d) {
+		if n, err := e.sweepBlobs(); err != nil {
+			log.Println("sweep icon blobs:", err)
+		} else if n != 0 {
+			log.Printf("deleted %d unused icon blobs", n)
+		}
+	}
+}
+
+// mapResources holds valid font and image files uploaded with a map by name.
+type mapResources struct {
+	fonts  map[string][]byte
+	images map[string][]byte
+}
+
+func (r mapResources) empty() bool {
+	return len(r.fonts) == 0 && len(r.images) == 0
+}
+
+// handleResourceUpload stores font and image files uploaded with the map,
+// and returns the valid ones.
+func (e *editor) handleResourceUpload(mm *mapMeta, batch keyvalue.Batch, form *multipartForm, errh func(error)) mapResources {
+	res := mapResources{
+		fonts:  make(map[string][]byte),
+		images: make(map[string][]byte),
+	}
+	for _, f := range form.Files["fonts"] {
+		name := filepath.Base(f.Filename)
+		if err := checkFontFile(name, f.Content); err != nil {
+			errh(err)
+			continue
+		}
+		res.fonts[name] = f.Content
+		batch.Set(mapFontKey(mm.Key, name), f.Content)
+	}
+	for _, f := range form.Files["images"] {
+		name := filepath.Base(f.Filename)
+		if err := checkImageFile(name, f.Content); err != nil {
+			errh(err)
+			continue
+		}
+		res.images[name] = f.Content
+		batch.Set(mapImageKey(mm.Key, name), f.Content)
+	}
+	return res
+}
+
+func (e *editor) handleUIMapSave(mm *mapMeta, batch keyvalue.Batch, cache *iconCache, form *multipartForm,
+	newRes mapResources, errh func(error)) {
 	listFile, newList := form.File("listtxt")
 	styleFile, newStyle := form.File("iconstyle")
 
-	if !newList && !newStyle {
+	if !newList && !newStyle && newRes.empty() {
 		return
 	}
 
@@ -303,7 +392,9 @@ func (e *editor) handleUIMapSave(mm *mapMeta, batch keyvalue.Batch, form *multip
 		}
 	}
 
-	styler, err := NewStyler(bytes.NewReader(styleBytes), e.fontSrc)
+	fontSrc := fontSources(fontMap(newRes.fonts), e.mdb.FontSource(mm.Key), e.fontSrc)
+	imageSrc := imageSources(imageMap(newRes.images), e.mdb.ImageSource(mm.Key))
+	styler, err := NewStyler(bytes.NewReader(styleBytes), fontSrc, imageSrc)
 	if err != nil {
 		errh(err)
 	}
@@ -331,6 +422,20 @@ func (e *editor) handleUIMapSave(mm *mapMeta, batch keyvalue.Batch, form *multip
 	}
 	pubs = pubs[:j]
 
+	// drop pubs without icons, so that the map
+	// and the KMZ don't refer to missing icons
+	icons := renderPubIcons(pubs, styler, cache, styler.sprites)
+	j = 0
+	for i, p := range pubs {
+		if err := icons[i].err; err != nil {
+			errh(errors.Wrapf(err, "icon of %s", p.Label))
+			continue
+		}
+		pubs[j], icons[j] = p, icons[i]
+		j++
+	}
+	pubs, icons = pubs[:j], icons[:j]
+
 	mm.PubCount = len(pubs)
 
 	srcKey := "src|" + mm.Key
@@ -355,13 +460,106 @@ func (e *editor) handleUIMapSave(mm *mapMeta, batch keyvalue.Batch, form *multip
 		errh(err)
 	}
 
-	batch.Set("path|"+path.Join(mm.Key, pubjson), pubListJSON(pubs, ""))
-	for _, p := range pubs {
-		data, err := pubIconData(p, styler)
+	if lj, lp, err := legendData(styler); err != nil {
+		errh(errors.Wrap(err, "legend"))
+	} else if lj != nil {
+		batch.Set("path|"+path.Join(mm.Key, legendJSON), lj)
+		batch.Set("path|"+path.Join(mm.Key, legendPNG), lp)
+	}
+
+	var sprites *spriteSheet
+	if styler.sprites && len(pubs) != 0 {
+		sizes := make([]int, len(pubs))
+		for i, p := range pubs {
+			sizes[i] = styler.PubIconSize(p)
+		}
+		sprites = newSpriteSheet(sizes)
+	}
+
+	hasSVG := make([]bool, len(pubs))
+	for i, p := range pubs {
+		ic := icons[i]
+		for j, scale := range iconScales {
+			iconKey := "path|" + path.Join(mm.Key, p.IconVariantBasename(scale))
+			batch.Set(iconKey, ic.refs[j])
+			if sprites != nil {
+				sprites.draw(i, scale, ic.images[j])
+			}
+		}
+		if ic.svgErr != nil {
+			errh(errors.Wrapf(ic.svgErr, "vector icon of %s", p.Label))
+		} else if ic.svg != nil {
+			batch.Set("path|"+path.Join(mm.Key, p.IconSVGBasename()), ic.svg)
+			hasSVG[i] = true
+		}
+	}
+
+	if sprites != nil {
+		files, err := sprites.encode()
 		if err != nil {
-			log.Fatal(err)
+			errh(errors.Wrap(err, "sprites"))
+			sprites = nil
+		}
+		for name, data := range files {
+			batch.Set("path|"+path.Join(mm.Key, name), data)
 		}
-		iconKey := "path|" + path.Join(mm.Key, p.IconBasename())
-		batch.Set(iconKey, data)
 	}
+	batch.Set("path|"+path.Join(mm.Key, pubjson), pubListJSON(pubs, "", styler, sprites, hasSVG))
+}
+
+// pubIcons holds the rendered icons of a pub.
+type pubIcons struct {
+	refs   [][]byte      // blob references by iconScales
+	images []image.Image // images by iconScales, if requested
+	err    error
+
+	svg    []byte // vector icon, if enabled
+	svgErr error
+}
+
+// renderPubIcons renders the icons of pubs for all iconScales
+// using one goroutine per CPU.
+// Images are returned only if needImages is set.
+func renderPubIcons(pubs []Pub, styler *Styler, cache *iconCache, needImages bool) []pubIcons {
+	icons := make([]pubIcons, len(pubs))
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(pubs) {
+		workers = len(pubs)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				icons[i] = renderPubIcon(pubs[i], styler, cache, needImages)
+			}
+		}()
+	}
+	for i := range pubs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return icons
+}
+
+func renderPubIcon(p Pub, styler *Styler, cache *iconCache, needImages bool) pubIcons {
+	var ic pubIcons
+	for _, scale := range iconScales {
+		ref, im, err := cache.icon(styler.pubJob(p, scale), needImages)
+		if err != nil {
+			return pubIcons{err: err}
+		}
+		ic.refs = append(ic.refs, ref)
+		ic.images = append(ic.images, im)
+	}
+	if styler.svg {
+		ic.svg, ic.svgErr = styler.PubIconSVG(p)
+	}
+	return ic
 }
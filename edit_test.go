@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/tajtiattila/beermap/keyvalue"
+	"github.com/tajtiattila/geocode"
+)
+
+// fixedGeocoder finds every address at the same place.
+type fixedGeocoder struct{}
+
+func (fixedGeocoder) Geocode(query string) (geocode.Result, error) {
+	return geocode.Result{Lat: 47.5, Long: 19.05}, nil
+}
+
+func (fixedGeocoder) Close() error { return nil }
+
+// failingDB is a keyvalue.DB failing to get the key fail.
+type failingDB struct {
+	keyvalue.DB
+	fail string
+}
+
+func (db failingDB) Get(key string) ([]byte, error) {
+	if key == db.fail {
+		return nil, errors.New("read error")
+	}
+	return db.DB.Get(key)
+}
+
+func TestSaveDropsPubsWithoutIcons(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	const style = `{
+		"font": "Roboto-Medium.ttf",
+		"sprites": true,
+		"styles": [{"shape": "circle", "color": "red"}]
+	}`
+	const list = "[1] One\n(Main Street 1)\n\n[2] Two\n(Main Street 2)\n\n[3] Three\n(Main Street 3)\n"
+
+	// the icon of pub 2 can't be looked up in the render cache
+	st := newTestStyler(t, style)
+	fdb := failingDB{db, renderKey(st.pubJob(Pub{Label: "2"}, 2).key())}
+
+	e := &editor{mdb: &mapDB{fdb}, gc: fixedGeocoder{}, fontSrc: fontDir("res")}
+	form := &multipartForm{Files: map[string][]multipartFile{
+		"listtxt":   {{Filename: "list.txt", Content: []byte(list)}},
+		"iconstyle": {{Filename: "style.json", Content: []byte(style)}},
+	}}
+	mm := &mapMeta{Key: "test"}
+	var errs []string
+	batch := db.Batch()
+	e.handleUIMapSave(mm, batch, newIconCache(fdb, batch), form, mapResources{}, func(err error) {
+		errs = append(errs, err.Error())
+	})
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 1 || !strings.HasPrefix(errs[0], "icon of 2:") {
+		t.Errorf("got errors %q, want icon of 2", errs)
+	}
+	if mm.TotalPubCount != 3 || mm.PubCount != 2 {
+		t.Errorf("got %d of %d pubs, want 2 of 3", mm.PubCount, mm.TotalPubCount)
+	}
+
+	raw, err := getPath(db, "path|"+path.Join(mm.Key, pubjson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var md mapData
+	if err := json.Unmarshal(raw, &md); err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, jp := range md.Pubs {
+		labels = append(labels, jp.Label)
+		for _, u := range jp.Icons {
+			if _, err := getPath(db, "path|"+path.Join(mm.Key, u)); err != nil {
+				t.Errorf("%s: icon %s: %v", jp.Label, u, err)
+			}
+		}
+		if jp.Sprite == nil {
+			t.Errorf("%s: missing sprite", jp.Label)
+		}
+	}
+	if strings.Join(labels, " ") != "1 3" {
+		t.Errorf("got pubs %q, want 1 3", labels)
+	}
+	if md.Sprites == nil || md.Sprites.Width*md.Sprites.Height < 2*28*28 ||
+		md.Sprites.Width*md.Sprites.Height >= 3*28*28 {
+		t.Errorf("got sprites %+v, want sheet of two icons", md.Sprites)
+	}
+
+	if _, err := db.Get("path|" + path.Join(mm.Key, Pub{Label: "2"}.IconBasename())); err != keyvalue.ErrNotFound {
+		t.Errorf("icon of pub 2 stored: %v", err)
+	}
+
+	var src []Pub
+	raw, err = db.Get("src|" + mm.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(raw, &src); err != nil {
+		t.Fatal(err)
+	}
+	if len(src) != 2 {
+		t.Errorf("got %d pubs in src, want 2", len(src))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tajtiattila/beermap/icon"
+)
+
+// FontSource returns raw TTF font data by name.
+type FontSource = ResourceSource
+
+// errFontNotFound is returned by font sources that don't have the font.
+var errFontNotFound = errors.New("font not found")
+
+var fontFiles = resourceKind{"font", []string{".ttf"}, errFontNotFound}
+
+// isFontFile reports if name refers to a font file
+// rather than a Google font such as "Roboto:500".
+func isFontFile(name string) bool {
+	return fontFiles.isFile(name)
+}
+
+// validFontFileName reports if name may be used
+// to store or look up a font file.
+func validFontFileName(name string) bool {
+	return fontFiles.validFileName(name)
+}
+
+// fontSources returns a FontSource trying srcs in order.
+func fontSources(srcs ...FontSource) FontSource {
+	return fontFiles.sources(srcs...)
+}
+
+// fontDir returns a FontSource reading font files from dir.
+func fontDir(dir string) FontSource {
+	return fontFiles.dir(dir)
+}
+
+// fontMap returns a FontSource serving font files from m.
+func fontMap(m map[string][]byte) FontSource {
+	return fontFiles.files(m)
+}
+
+// serverFonts returns the FontSource for fonts available to all maps.
+// Font files are read from dir, other names are looked up using google.
+func serverFonts(dir string, google FontSource) FontSource {
+	files := fontDir(dir)
+	return func(name string) ([]byte, error) {
+		if isFontFile(name) {
+			return files(name)
+		}
+		return google(name)
+	}
+}
+
+// checkFontFile verifies an uploaded font file.
+func checkFontFile(name string, raw []byte) error {
+	if !validFontFileName(name) {
+		return errors.Errorf("invalid font file name %q", name)
+	}
+	if _, err := icon.ParseFont(raw); err != nil {
+		return errors.Wrapf(err, "font %q", name)
+	}
+	return nil
+}
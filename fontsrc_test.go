@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCheckFontFile(t *testing.T) {
+	roboto, err := ioutil.ReadFile("res/Roboto-Medium.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cff := append([]byte("OTTO"), make([]byte, 64)...)
+
+	tests := []struct {
+		name string
+		raw  []byte
+		err  string
+	}{
+		{"Roboto.ttf", roboto, ""},
+		{"Roboto.otf", roboto, "invalid font file name"},
+		{"../Roboto.ttf", roboto, "invalid font file name"},
+		{"Source.ttf", cff, "CFF fonts are not supported"},
+		{"Garbage.ttf", []byte("garbage"), "can't parse font"},
+	}
+	for _, x := range tests {
+		err := checkFontFile(x.name, x.raw)
+		switch {
+		case x.err == "" && err != nil:
+			t.Errorf("%s: %v", x.name, err)
+		case x.err != "" && (err == nil || !strings.Contains(err.Error(), x.err)):
+			t.Errorf("%s: got error %v, want %q", x.name, err, x.err)
+		}
+	}
+}
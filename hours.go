@@ -0,0 +1,252 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const minutesPerDay = 24 * 60
+
+// OpeningHours is a weekly opening schedule.
+type OpeningHours struct {
+	// Src is the schedule in OSM opening_hours syntax,
+	// eg. "Mo-Fr 15:00-23:00; Sa 12:00-24:00".
+	Src string `json:"text"`
+
+	// Week holds open periods indexed by time.Weekday.
+	Week [7][]TimeSpan `json:"week"`
+}
+
+// TimeSpan is an open period in minutes from midnight.
+// Close may exceed 24*60 for periods ending after midnight.
+type TimeSpan struct {
+	Open  int `json:"open"`
+	Close int `json:"close"`
+}
+
+// ParseOpeningHours parses a subset of the OSM opening_hours syntax.
+//
+// Rules are separated by semicolons, and later rules override
+// earlier ones for the days they specify. Each rule is
+// an optional list of weekdays or weekday ranges followed by
+// a list of time spans, or "off" or "closed".
+// A rule without weekdays applies to every day,
+// and "24/7" means always open.
+func ParseOpeningHours(s string) (*OpeningHours, error) {
+	h := &OpeningHours{Src: strings.TrimSpace(s)}
+	for i := range h.Week {
+		h.Week[i] = []TimeSpan{}
+	}
+
+	for _, rule := range strings.Split(h.Src, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if err := h.parseRule(rule); err != nil {
+			return nil, errors.Wrapf(err, "opening hours rule %q", rule)
+		}
+	}
+
+	return h, nil
+}
+
+func (h *OpeningHours) parseRule(rule string) error {
+	if rule == "24/7" {
+		for i := range h.Week {
+			h.Week[i] = []TimeSpan{{0, minutesPerDay}}
+		}
+		return nil
+	}
+
+	f := strings.Fields(rule)
+
+	var days [7]bool
+	if d, err := parseWeekdays(f[0]); err == nil {
+		days = d
+		f = f[1:]
+	} else if startsWithLetter(f[0]) && !isOffRule(f[0]) {
+		return err
+	} else {
+		for i := range days {
+			days[i] = true
+		}
+	}
+
+	var spans []TimeSpan
+	switch {
+	case len(f) == 0:
+		// weekdays only means open all day
+		spans = []TimeSpan{{0, minutesPerDay}}
+	case len(f) == 1 && isOffRule(f[0]):
+		spans = []TimeSpan{}
+	default:
+		for _, x := range strings.Split(strings.Join(f, ""), ",") {
+			span, err := parseTimeSpan(x)
+			if err != nil {
+				return err
+			}
+			spans = append(spans, span)
+		}
+	}
+
+	for i, ok := range days {
+		if ok {
+			h.Week[i] = spans
+		}
+	}
+	return nil
+}
+
+// OpenAt reports if h is open at time t.
+func (h *OpeningHours) OpenAt(t time.Time) bool {
+	return h.openAt(t.Weekday(), t.Hour()*60+t.Minute())
+}
+
+// openAt reports if h is open on day at minute m from midnight.
+func (h *OpeningHours) openAt(day time.Weekday, m int) bool {
+	for _, s := range h.Week[day] {
+		if s.Open <= m && m < s.Close {
+			return true
+		}
+	}
+
+	// periods from the previous day extending past midnight
+	prev := (day + 6) % 7
+	for _, s := range h.Week[prev] {
+		if s.Open <= m+minutesPerDay && m+minutesPerDay < s.Close {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *OpeningHours) String() string {
+	return h.Src
+}
+
+var osmWeekdays = []string{"Su", "Mo", "Tu", "We", "Th", "Fr", "Sa"}
+
+// parseWeekdays parses weekday lists such as "Mo-Fr" or "Mo,We,Fr-Su".
+func parseWeekdays(s string) (days [7]bool, err error) {
+	for _, part := range strings.Split(s, ",") {
+		var first, last time.Weekday
+		var ok bool
+		if i := strings.IndexRune(part, '-'); i >= 0 {
+			first, ok = parseWeekday(part[:i])
+			if ok {
+				last, ok = parseWeekday(part[i+1:])
+			}
+		} else {
+			first, ok = parseWeekday(part)
+			last = first
+		}
+		if !ok {
+			return days, errors.Errorf("invalid weekday %q", part)
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseWeekday parses an OSM (Mo), short English (Mon)
+// or full English (Monday) weekday name.
+func parseWeekday(s string) (time.Weekday, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	for i, n := range osmWeekdays {
+		if !strings.EqualFold(s[:2], n) {
+			continue
+		}
+		full := time.Weekday(i).String()
+		if len(s) == 2 || len(s) == 3 && strings.EqualFold(s, full[:3]) ||
+			strings.EqualFold(s, full) {
+			return time.Weekday(i), true
+		}
+	}
+	return 0, false
+}
+
+// parseTimeSpan parses spans like "15:00-23:00".
+// The end of span may be past midnight, eg. "18:00-02:00" or "18:00-26:00".
+func parseTimeSpan(s string) (TimeSpan, error) {
+	i := strings.IndexRune(s, '-')
+	if i < 0 {
+		return TimeSpan{}, errors.Errorf("invalid time span %q", s)
+	}
+	start, err := parseClock(s[:i], minutesPerDay-1)
+	if err != nil {
+		return TimeSpan{}, err
+	}
+	end, err := parseClock(s[i+1:], 2*minutesPerDay)
+	if err != nil {
+		return TimeSpan{}, err
+	}
+	if end <= start {
+		end += minutesPerDay
+	}
+	if end-start > minutesPerDay {
+		return TimeSpan{}, errors.Errorf("time span %q too long", s)
+	}
+	return TimeSpan{start, end}, nil
+}
+
+// parseClock parses a time like "22:30" into minutes from midnight.
+func parseClock(s string, max int) (int, error) {
+	i := strings.IndexRune(s, ':')
+	if i < 0 || len(s)-i != 3 {
+		return 0, errors.Errorf("invalid time %q", s)
+	}
+	h, err := strconv.Atoi(s[:i])
+	if err != nil || h < 0 {
+		return 0, errors.Errorf("invalid time %q", s)
+	}
+	m, err := strconv.Atoi(s[i+1:])
+	if err != nil || m < 0 || m >= 60 {
+		return 0, errors.Errorf("invalid time %q", s)
+	}
+	v := h*60 + m
+	if v > max {
+		return 0, errors.Errorf("time %q out of range", s)
+	}
+	return v, nil
+}
+
+// parseWeekTime parses a weekday and time such as "Fri 22:30".
+func parseWeekTime(s string) (time.Weekday, int, error) {
+	f := strings.Fields(s)
+	if len(f) != 2 {
+		return 0, 0, errors.Errorf("invalid weekday and time %q", s)
+	}
+	day, ok := parseWeekday(f[0])
+	if !ok {
+		return 0, 0, errors.Errorf("invalid weekday %q", f[0])
+	}
+	m, err := parseClock(f[1], minutesPerDay-1)
+	if err != nil {
+		return 0, 0, err
+	}
+	return day, m, nil
+}
+
+func isOffRule(s string) bool {
+	return s == "off" || s == "closed"
+}
+
+func startsWithLetter(s string) bool {
+	if s == "" {
+		return false
+	}
+	c := s[0] | 0x20
+	return 'a' <= c && c <= 'z'
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpeningHours(t *testing.T) {
+	tests := []struct {
+		src  string
+		when string
+		want bool
+	}{
+		{"Mo-Fr 15:00-23:00; Sa 12:00-24:00", "Mon 15:00", true},
+		{"Mo-Fr 15:00-23:00; Sa 12:00-24:00", "Mon 14:59", false},
+		{"Mo-Fr 15:00-23:00; Sa 12:00-24:00", "Fri 22:59", true},
+		{"Mo-Fr 15:00-23:00; Sa 12:00-24:00", "Fri 23:00", false},
+		{"Mo-Fr 15:00-23:00; Sa 12:00-24:00", "Sat 23:59", true},
+		{"Mo-Fr 15:00-23:00; Sa 12:00-24:00", "Sun 00:00", false},
+		{"Fr-Sa 18:00-02:00", "Sat 01:30", true},
+		{"Fr-Sa 18:00-02:00", "Sun 01:30", true},
+		{"Fr-Sa 18:00-02:00", "Sun 02:00", false},
+		{"Fr-Sa 18:00-02:00", "Fri 01:30", false},
+		{"Mo,We 11:00-14:00, 18:00-22:00", "Wed 19:00", true},
+		{"Mo,We 11:00-14:00, 18:00-22:00", "Wed 15:00", false},
+		{"Mo,We 11:00-14:00, 18:00-22:00", "Tue 12:00", false},
+		{"10:00-20:00; Su off", "Thu 12:00", true},
+		{"10:00-20:00; Su off", "Sun 12:00", false},
+		{"Sa-Mo 12:00-13:00", "Sun 12:30", true},
+		{"Sa-Mo 12:00-13:00", "Tue 12:30", false},
+		{"24/7", "Tue 04:00", true},
+		{"Mo-Fr", "Tue 04:00", true},
+	}
+
+	for _, x := range tests {
+		h, err := ParseOpeningHours(x.src)
+		if err != nil {
+			t.Fatalf("%q: %v", x.src, err)
+		}
+		day, m, err := parseWeekTime(x.when)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := h.openAt(day, m); got != x.want {
+			t.Errorf("%q open at %s got %v, want %v", x.src, x.when, got, x.want)
+		}
+	}
+}
+
+func TestOpeningHoursErrors(t *testing.T) {
+	tests := []string{
+		"Mo-Fr 15:00",
+		"Mo-Xy 15:00-23:00",
+		"PH off",
+		"Mo 25:00-26:00",
+		"Mo 15:00-23:60",
+		"Mo 10:00-12:00+",
+	}
+	for _, src := range tests {
+		if _, err := ParseOpeningHours(src); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+}
+
+func TestOpenCond(t *testing.T) {
+	h, err := ParseOpeningHours("Mo-Fr 15:00-23:00; Sa 12:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubs := []Pub{
+		{Label: "a", Hours: h},
+		{Label: "b"},
+	}
+
+	loc := time.FixedZone("test", 2*60*60)
+	env, err := newCondEnv(nil, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Friday 20:30 UTC is 22:30 in loc
+	env.now = func() time.Time {
+		return time.Date(2019, 5, 3, 20, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`open_at("Fri 22:30")`, "a"},
+		{`open_at("Friday 23:30")`, ""},
+		{`not open_at("Sun 12:00")`, "ab"},
+		{`open_now`, "a"},
+		{`not open_now`, "b"},
+	}
+
+	for _, x := range tests {
+		cond, err := decodeCondStringEnv(x.src, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got string
+		for _, p := range pubs {
+			if cond.Accept(p) {
+				got += p.Label
+			}
+		}
+
+		if got != x.want {
+			t.Errorf("%s accept got %v, want %v", x.src, got, x.want)
+		}
+	}
+
+	for _, src := range []string{`open_at`, `open_at(Fri)`, `open_at("Fri 22:30"`, `open_at("Fri")`, `open_at("Fri 22:30)`} {
+		if _, err := decodeCondStringEnv(src, env); err == nil {
+			t.Errorf("%s: want error", src)
+		}
+	}
+}
+
+func TestDuplicateHours(t *testing.T) {
+	src := `[1] Pub
+(Main Street 1)
+hours: Mo-Fr 15:00-23:00
+hours: Sa 12:00-24:00
+`
+	var errs []error
+	pubs, err := parsePubList(strings.NewReader(src), nil, func(err error) error {
+		errs = append(errs, err)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pubs) != 0 || len(errs) != 1 || !strings.Contains(errs[0].Error(), "duplicate opening hours") {
+		t.Errorf("got pubs %v, errors %v; want duplicate opening hours error", pubs, errs)
+	}
+}
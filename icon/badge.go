@@ -0,0 +1,122 @@
+package icon
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Badge is a small marker drawn over a corner of an icon.
+type Badge struct {
+	Mark    BadgeMark
+	Corner  Corner
+	Color   color.Color // mark color
+	Outline color.Color // mark outline
+	Text    color.Color // letter color
+	Letter  string      // letter for LetterMark
+}
+
+// BadgeMark is the shape of a badge.
+type BadgeMark int
+
+const (
+	DotMark BadgeMark = iota
+	CrossMark
+	StarMark
+	LetterMark // letter on a dot
+)
+
+// Corner is an icon corner where badges are drawn.
+type Corner int
+
+const (
+	TopRight Corner = iota
+	TopLeft
+	BottomRight
+	BottomLeft
+)
+
+var (
+	dotBadge   = &shapeIcon{dist: circleDist, path: circlePath}
+	crossBadge = &shapeIcon{dist: crossDist(0.75, 0.3), path: crossPath(0.75, 0.3)}
+	starBadge  = polygonShape(starVertices(5, 0.5), 0, 0)
+)
+
+// badgeShape returns the shape drawn for mark.
+func badgeShape(mark BadgeMark) *shapeIcon {
+	switch mark {
+	case CrossMark:
+		return crossBadge
+	case StarMark:
+		return starBadge
+	}
+	return dotBadge
+}
+
+// AddBadges returns im with badges drawn over it.
+// Badges at the same corner are stacked towards the center of the edge,
+// later ones appearing on top.
+// Im is expected to have the margin of r around the icon, like from RenderEffects.
+func (r *Renderer) AddBadges(im image.Image, badges []Badge) image.Image {
+	if len(badges) == 0 {
+		return im
+	}
+
+	b := im.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, im, b.Min, draw.Src)
+
+	radius := float64(r.Dim) * 0.16
+	stroke := math.Max(1, float64(r.Stroke)*0.75)
+
+	var stack [4]int
+	for _, bg := range badges {
+		cx, cy := r.badgeCenter(bg.Corner, radius, stack[bg.Corner])
+		cx += float64(b.Min.X + r.Margin)
+		cy += float64(b.Min.Y + r.Margin)
+		stack[bg.Corner]++
+
+		s := badgeShape(bg.Mark)
+		if bg.Outline != nil {
+			s.fill(dst, bg.Outline, cx, cy, radius, 0)
+			s.fill(dst, bg.Color, cx, cy, radius, stroke)
+		} else {
+			s.fill(dst, bg.Color, cx, cy, radius, 0)
+		}
+
+		if bg.Mark == LetterMark && bg.Letter != "" {
+			c := image.Pt(int(cx+0.5), int(cy+0.5))
+			r.drawLabel(dst, bg.Text, bg.Letter, c, 2.5*radius/float64(r.Dim))
+		}
+	}
+	return dst
+}
+
+// badgeCenter returns the center of the nth badge at corner.
+func (r *Renderer) badgeCenter(corner Corner, radius float64, n int) (cx, cy float64) {
+	lo := float64(r.Padding) + radius
+	hi := float64(r.Dim-r.Padding) - radius
+	step := float64(n) * radius * 1.6
+
+	switch corner {
+	case TopLeft:
+		return lo + step, lo
+	case BottomRight:
+		return hi - step, hi
+	case BottomLeft:
+		return lo + step, hi
+	}
+	return hi - step, lo
+}
+
+// crossDist returns the signed distance function of an X
+// with arms reaching arm and having half width w.
+func crossDist(arm, w float64) func(x, y float64) float64 {
+	return func(x, y float64) float64 {
+		// distance from the diagonals, folded into the first quadrant
+		x, y = math.Abs(x), math.Abs(y)
+		t := clamp((x+y)/2, 0, arm)
+		return math.Hypot(x-t, y-t) - w
+	}
+}
@@ -0,0 +1,161 @@
+package icon
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Effect is a blurred copy of the icon silhouette
+// drawn behind the icon, such as a drop shadow or an outer glow.
+type Effect struct {
+	Color  color.Color
+	Radius float64     // blur radius in pixels
+	Offset image.Point // offset from the icon, zero for a glow
+}
+
+// Scaled returns e with its radius and offset scaled by f.
+func (e Effect) Scaled(f float64) Effect {
+	e.Radius *= f
+	e.Offset.X = int(math.Round(float64(e.Offset.X) * f))
+	e.Offset.Y = int(math.Round(float64(e.Offset.Y) * f))
+	return e
+}
+
+// EffectMargin returns the margin needed around an icon
+// so that effects are drawn without clipping.
+// The blur reaches the radius rounded up beyond the silhouette,
+// which may touch the edge of the icon, and one more transparent pixel
+// is kept at the edge of the image.
+func EffectMargin(effects []Effect) int {
+	if len(effects) == 0 {
+		return 0
+	}
+	var m int
+	for _, e := range effects {
+		o := e.Offset
+		if o.X < 0 {
+			o.X = -o.X
+		}
+		if o.Y < 0 {
+			o.Y = -o.Y
+		}
+		if o.Y > o.X {
+			o.X = o.Y
+		}
+		if v := int(math.Ceil(math.Max(e.Radius, 0))) + o.X; v > m {
+			m = v
+		}
+	}
+	return m + 1
+}
+
+// RenderEffects renders d like Render, and draws effects behind it.
+// Effects are drawn in order, so later ones appear on top.
+// The icon is drawn with the margin of r around it,
+// so the image is Dim+2*Margin pixels wide and high.
+// The shape keeps its size, and effects extending
+// beyond the margin are clipped at the edge of the image.
+func (r *Renderer) RenderEffects(d Drawable, c Colors, label string, effects []Effect) image.Image {
+	im := r.Render(d, c, label)
+	if len(effects) == 0 && r.Margin == 0 {
+		return im
+	}
+
+	m := r.Margin
+	b := image.Rect(0, 0, r.Dim+2*m, r.Dim+2*m)
+	src := image.NewRGBA(b)
+	ib := im.Bounds()
+	draw.Draw(src, ib.Sub(ib.Min).Add(image.Pt(m, m)), im, ib.Min, draw.Src)
+
+	dst := image.NewRGBA(b)
+	for _, e := range effects {
+		e.draw(dst, src)
+	}
+	draw.Draw(dst, b, src, b.Min, draw.Over)
+	return dst
+}
+
+func (e Effect) draw(dst draw.Image, src image.Image) {
+	mask := blurAlpha(src, e.Radius)
+	b := dst.Bounds()
+	draw.DrawMask(dst, b, image.NewUniform(e.Color), image.Point{},
+		mask, b.Min.Sub(e.Offset), draw.Over)
+}
+
+// blurAlpha returns the alpha channel of src
+// blurred with a Gaussian filter of the given radius.
+func blurAlpha(src image.Image, radius float64) *image.Alpha {
+	b := src.Bounds()
+	dst := image.NewAlpha(b)
+	draw.Draw(dst, b, src, b.Min, draw.Src)
+
+	kernel := gaussKernel(radius)
+	if len(kernel) < 2 {
+		return dst
+	}
+
+	w, h := b.Dx(), b.Dy()
+	v := make([]float64, w*h)
+	for i := range v {
+		v[i] = float64(dst.Pix[(i/w)*dst.Stride+i%w])
+	}
+
+	tmp := make([]float64, w*h)
+	convolve(tmp, v, w, h, 1, w, kernel)
+	convolve(v, tmp, h, w, w, 1, kernel)
+
+	for i, x := range v {
+		dst.Pix[(i/w)*dst.Stride+i%w] = uint8(math.Min(x, 255) + 0.5)
+	}
+	return dst
+}
+
+// convolve applies the symmetric kernel to src along lines of length n.
+// Elements within a line are step apart, and lines start stride apart.
+func convolve(dst, src []float64, n, lines, step, stride int, kernel []float64) {
+	k := len(kernel) - 1
+	for l := 0; l < lines; l++ {
+		base := l * stride
+		for i := 0; i < n; i++ {
+			var sum float64
+			for j := -k; j <= k; j++ {
+				p := i + j
+				if p < 0 || p >= n {
+					continue
+				}
+				kj := j
+				if kj < 0 {
+					kj = -kj
+				}
+				sum += kernel[kj] * src[base+p*step]
+			}
+			dst[base+i*step] = sum
+		}
+	}
+}
+
+// gaussKernel returns the normalized right half of a Gaussian kernel,
+// the first element being the center.
+func gaussKernel(radius float64) []float64 {
+	sigma := radius / 2
+	if sigma <= 0 {
+		return []float64{1}
+	}
+	n := int(math.Ceil(radius))
+	kernel := make([]float64, n+1)
+	var sum float64
+	for i := range kernel {
+		kernel[i] = math.Exp(-float64(i*i) / (2 * sigma * sigma))
+		if i == 0 {
+			sum += kernel[i]
+		} else {
+			sum += 2 * kernel[i]
+		}
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
@@ -0,0 +1,156 @@
+package icon
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestGaussKernel(t *testing.T) {
+	for _, radius := range []float64{0, -1, 0.5, 1, 2.5, 4, 10} {
+		k := gaussKernel(radius)
+		if want := int(math.Ceil(math.Max(radius, 0))) + 1; radius > 0 && len(k) != want {
+			t.Errorf("radius %v: got %d elements, want %d", radius, len(k), want)
+		}
+		sum := k[0]
+		for i, v := range k[1:] {
+			sum += 2 * v
+			if v > k[i] {
+				t.Errorf("radius %v: kernel not decreasing at %d", radius, i+1)
+			}
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("radius %v: kernel sum is %v", radius, sum)
+		}
+	}
+	if k := gaussKernel(0); len(k) != 1 {
+		t.Errorf("zero radius: got kernel %v, want [1]", k)
+	}
+}
+
+func TestBlurAlpha(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	draw.Draw(src, image.Rect(5, 5, 15, 15), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	same := blurAlpha(src, 0)
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			if got, want := same.AlphaAt(x, y).A, src.RGBAAt(x, y).A; got != want {
+				t.Fatalf("zero radius: got alpha %d at %d,%d, want %d", got, x, y, want)
+			}
+		}
+	}
+
+	blurred := blurAlpha(src, 3)
+	var before, after int
+	for i := range blurred.Pix {
+		before += int(src.Pix[4*i+3])
+		after += int(blurred.Pix[i])
+	}
+	// the kernel is normalized, so the total alpha is kept within rounding
+	if d := before - after; d < -len(blurred.Pix)/2 || d > len(blurred.Pix)/2 {
+		t.Errorf("total alpha changed from %d to %d", before, after)
+	}
+	if a := blurred.AlphaAt(3, 10).A; a == 0 || a == 255 {
+		t.Errorf("got alpha %d outside the edge, want partial", a)
+	}
+	if a := blurred.AlphaAt(10, 10).A; a != 255 {
+		t.Errorf("got alpha %d at the center, want 255", a)
+	}
+}
+
+func TestRenderEffectsKeepsShape(t *testing.T) {
+	colors := SimpleColors(color.RGBA{0xc0, 0, 0, 0xff})
+	effects := []Effect{{Color: color.RGBA{0xff, 0xff, 0, 0xff}, Radius: 5}}
+	for _, margin := range []int{0, EffectMargin(effects)} {
+		r := newTestRenderer(t).WithMargin(margin)
+		plain := r.Render(Circle, colors, "")
+		glow := r.RenderEffects(Circle, colors, "", effects)
+
+		want := plain.Bounds().Inset(-margin)
+		if glow.Bounds().Size() != want.Size() {
+			t.Fatalf("margin %d: got bounds %v, want size %v", margin, glow.Bounds(), want.Size())
+		}
+		b := plain.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if _, _, _, a := plain.At(x, y).RGBA(); a != 0xffff {
+					continue
+				}
+				if !sameRGBA(plain.At(x, y), glow.At(x+margin, y+margin)) {
+					t.Fatalf("margin %d: got %v at %d,%d with glow, want %v", margin,
+						glow.At(x+margin, y+margin), x, y, plain.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+func TestEffectMargin(t *testing.T) {
+	tests := []struct {
+		effects []Effect
+		want    int
+	}{
+		{nil, 0},
+		{[]Effect{{Radius: 5}}, 6},
+		{[]Effect{{Radius: 2.5}}, 4},
+		{[]Effect{{Radius: 4, Offset: image.Pt(1, 2)}}, 7},
+		{[]Effect{{Radius: 4, Offset: image.Pt(-3, 0)}, {Radius: 5}}, 8},
+		{[]Effect{{Radius: 16, Offset: image.Pt(8, -8)}}, 25},
+	}
+	for _, tt := range tests {
+		if got := EffectMargin(tt.effects); got != tt.want {
+			t.Errorf("%v: got %d, want %d", tt.effects, got, tt.want)
+		}
+	}
+}
+
+func TestRenderEffectsMargin(t *testing.T) {
+	colors := SimpleColors(color.RGBA{0xc0, 0, 0, 0xff})
+	tests := [][]Effect{
+		{{Color: color.RGBA{0xff, 0xff, 0, 0xff}, Radius: 16}},
+		{{Color: color.Black, Radius: 4, Offset: image.Pt(8, 8)}},
+		{{Color: color.Black, Radius: 16, Offset: image.Pt(-8, 8)}},
+	}
+	for _, effects := range tests {
+		for _, d := range []Drawable{Circle, Square, Pin} {
+			r := newTestRenderer(t).WithMargin(EffectMargin(effects))
+			im := r.RenderEffects(d, colors, "12", effects)
+			b := im.Bounds()
+			if b.Dx() != r.Dim+2*r.Margin || b.Dy() != r.Dim+2*r.Margin {
+				t.Fatalf("%v: got bounds %v, want %d pixels", effects, b, r.Dim+2*r.Margin)
+			}
+
+			// the effect fades out before the edge of the image
+			for i := 0; i < b.Dx(); i++ {
+				for _, p := range []image.Point{
+					{b.Min.X + i, b.Min.Y}, {b.Min.X + i, b.Max.Y - 1},
+					{b.Min.X, b.Min.Y + i}, {b.Max.X - 1, b.Min.Y + i},
+				} {
+					if _, _, _, a := im.At(p.X, p.Y).RGBA(); a != 0 {
+						t.Fatalf("%v: got alpha %d at the edge %v", effects, a, p)
+					}
+				}
+			}
+
+			// but is drawn in the margin
+			var visible bool
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if _, _, _, a := im.At(x, b.Max.Y-r.Margin).RGBA(); a != 0 {
+					visible = true
+				}
+			}
+			if !visible {
+				t.Errorf("%v: effect not drawn in the margin", effects)
+			}
+		}
+	}
+}
+
+func sameRGBA(a, b color.Color) bool {
+	r0, g0, b0, a0 := a.RGBA()
+	r1, g1, b1, a1 := b.RGBA()
+	return r0 == r1 && g0 == g1 && b0 == b1 && a0 == a1
+}
@@ -7,20 +7,23 @@ import (
 	"image/draw"
 	"image/png"
 	"io/ioutil"
-	"log"
-	"math"
 
 	"github.com/golang/freetype"
 	"github.com/golang/freetype/truetype"
 	"github.com/pkg/errors"
 )
 
+// Renderer renders icons with a font.
+// A Renderer is safe for concurrent use by multiple goroutines.
 type Renderer struct {
-	font *truetype.Font
+	// fonts holds the label font followed by fallback fonts
+	// used for characters missing from the ones before
+	fonts []*truetype.Font
 
 	Dim     int // icon width and height
 	Padding int // padding, also shadow size
 	Stroke  int // outer stroke width
+	Margin  int // space around the icon for effects, see RenderEffects
 }
 
 func NewRendererFontPath(fontpath string) (*Renderer, error) {
@@ -33,13 +36,37 @@ func NewRendererFontPath(fontpath string) (*Renderer, error) {
 }
 
 func NewRendererFont(fontdata []byte) (*Renderer, error) {
-	font, err := freetype.ParseFont(fontdata)
-	if err != nil {
-		return nil, errors.Wrap(err, "can't parse font")
+	return NewRendererFonts(fontdata)
+}
+
+// NewRendererFonts returns a Renderer using the first font for labels,
+// and the rest in order for characters missing from the fonts before.
+func NewRendererFonts(fontdata ...[]byte) (*Renderer, error) {
+	if len(fontdata) == 0 {
+		return nil, errors.New("no font")
+	}
+
+	fonts := make([]*truetype.Font, len(fontdata))
+	for i, raw := range fontdata {
+		var err error
+		fonts[i], err = ParseFont(raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewRendererTrueType(fonts...)
+}
+
+// NewRendererTrueType returns a Renderer like NewRendererFonts
+// using parsed fonts, which may be shared with other renderers.
+func NewRendererTrueType(fonts ...*truetype.Font) (*Renderer, error) {
+	if len(fonts) == 0 {
+		return nil, errors.New("no font")
 	}
 
 	return &Renderer{
-		font: font,
+		fonts: fonts,
 
 		Dim:     56,
 		Padding: 2,
@@ -47,6 +74,44 @@ func NewRendererFont(fontdata []byte) (*Renderer, error) {
 	}, nil
 }
 
+// ParseFont parses TrueType font data.
+// OpenType fonts with CFF outlines are reported as unsupported.
+func ParseFont(raw []byte) (*truetype.Font, error) {
+	if bytes.HasPrefix(raw, []byte("OTTO")) {
+		return nil, errors.New("CFF fonts are not supported")
+	}
+	f, err := freetype.ParseFont(raw)
+	return f, errors.Wrap(err, "can't parse font")
+}
+
+// WithDim returns a copy of r rendering icons of size dim,
+// with padding, stroke and margin scaled accordingly.
+func (r *Renderer) WithDim(dim int) *Renderer {
+	rr := *r
+	rr.Dim = dim
+	rr.Padding = scaleInt(r.Padding, dim, r.Dim)
+	rr.Stroke = scaleInt(r.Stroke, dim, r.Dim)
+	rr.Margin = scaleInt(r.Margin, dim, r.Dim)
+	return &rr
+}
+
+// WithMargin returns a copy of r with margin pixels
+// of space around icons for effects.
+func (r *Renderer) WithMargin(margin int) *Renderer {
+	rr := *r
+	rr.Margin = margin
+	return &rr
+}
+
+// scaleInt returns v*num/den rounded, but at least 1 if v is positive.
+func scaleInt(v, num, den int) int {
+	x := (v*num + den/2) / den
+	if x == 0 && v > 0 {
+		return 1
+	}
+	return x
+}
+
 func (r *Renderer) Render(d Drawable, c Colors, label string) image.Image {
 	return d.Render(r, c, label)
 }
@@ -61,37 +126,25 @@ func (r *Renderer) RenderPNG(d Drawable, c Colors, label string) []byte {
 }
 
 func (r *Renderer) centerLabel(im draw.Image, textColor color.Color, label string) {
-	if label == "" {
-		return
-	}
+	center := r.Dim / 2
+	r.drawLabel(im, textColor, label, image.Pt(center, center), 1)
+}
 
-	var fs int
-	if len(label) <= 2 {
-		fs = 30
-	} else {
-		fs = 24
+// Fade returns im with its opacity multiplied by opacity.
+// It affects everything in im alike, so overlapping parts
+// such as the outline under the fill don't show through.
+func Fade(im image.Image, opacity float64) image.Image {
+	if opacity >= 1 {
+		return im
 	}
-	fs = r.Dim * fs / 56
-
-	c := freetype.NewContext()
-	c.SetFont(r.font)
-	c.SetSrc(image.NewUniform(textColor))
-	c.SetFontSize(float64(fs))
-	tdim, err := c.DrawString(label, freetype.Pt(0, 0))
-	if err != nil {
-		log.Println(err)
-		return
+	if opacity < 0 {
+		opacity = 0
 	}
-
-	center := r.Dim / 2
-
-	dy := (fs * 17 / 24) / 2
-	textp := freetype.Pt(center, center+dy)
-	textp.X -= tdim.X / 2
-
-	c.SetDst(im)
-	c.SetClip(im.Bounds())
-	c.DrawString(label, textp)
+	b := im.Bounds()
+	dst := image.NewRGBA(b)
+	mask := image.NewUniform(color.Alpha16{uint16(opacity*0xffff + 0.5)})
+	draw.DrawMask(dst, b, im, b.Min, mask, b.Min, draw.Src)
+	return dst
 }
 
 type Drawable interface {
@@ -113,104 +166,3 @@ func SimpleColors(fill color.Color) Colors {
 		Text:    color.White,
 	}
 }
-
-type circleIcon struct{}
-
-var Circle Drawable = circleIcon{}
-
-func (circleIcon) Render(r *Renderer, colors Colors, label string) image.Image {
-	center := r.Dim / 2
-	radius := center - r.Padding
-	im := image.NewRGBA(image.Rect(0, 0, r.Dim, r.Dim))
-
-	tmp := image.NewRGBA(image.Rect(0, 0, r.Dim, r.Dim))
-	drawCircle(tmp, colors.Shadow, center, center+r.Padding, radius)
-	draw.Draw(im, im.Bounds(), tmp, tmp.Bounds().Min, draw.Over)
-
-	if r.Stroke > 0 {
-		clearRGBA(tmp)
-		drawCircle(tmp, colors.Outline, center, center, radius)
-		draw.Draw(im, im.Bounds(), tmp, tmp.Bounds().Min, draw.Over)
-	}
-
-	clearRGBA(tmp)
-	drawCircle(tmp, colors.Fill, center, center, radius-r.Stroke)
-	draw.Draw(im, im.Bounds(), tmp, tmp.Bounds().Min, draw.Over)
-
-	r.centerLabel(im, colors.Text, label)
-
-	return im
-}
-
-func clearRGBA(im *image.RGBA) {
-	for i := range im.Pix {
-		im.Pix[i] = 0
-	}
-}
-
-func drawCircle(im draw.Image, c color.Color, cx, cy, r int) {
-	cn := color.NRGBAModel.Convert(c).(color.NRGBA)
-	alpha := float64(cn.A)
-	cr := image.Rect(cx-r, cy-r, cx+r, cy+r)
-	cr = im.Bounds().Intersect(cr)
-	for y := cr.Min.Y; y < cr.Max.Y; y++ {
-		fy := float64(y) + 0.5 - float64(cy)
-		for x := cr.Min.X; x < cr.Max.X; x++ {
-			fx := float64(x) + 0.5 - float64(cx)
-
-			rx := math.Sqrt(fx*fx + fy*fy)
-
-			v := rx - float64(r) + 0.5
-			switch {
-			case v < 0:
-				im.Set(x, y, c)
-			case v < 1:
-				cn.A = uint8(alpha * (1 - v))
-				im.Set(x, y, cn)
-			}
-		}
-	}
-}
-
-type squareIcon struct{}
-
-var Square Drawable = squareIcon{}
-
-func (squareIcon) Render(r *Renderer, colors Colors, label string) image.Image {
-	im := image.NewNRGBA(image.Rect(0, 0, r.Dim, r.Dim))
-
-	// top and bottom lines
-	for i := 0; i < r.Stroke; i++ {
-		yt := r.Padding + i
-		yb := r.Dim - r.Padding - i - 1
-		for x := r.Padding; x < r.Dim-r.Padding; x++ {
-			im.Set(x, yt, colors.Outline)
-			im.Set(x, yb, colors.Outline)
-		}
-	}
-
-	// middle section
-	ps := r.Padding + r.Stroke
-	xl := ps
-	xr := r.Dim - ps
-	for y := ps; y < r.Dim-ps; y++ {
-		for i := 0; i < r.Stroke; i++ {
-			im.Set(xl-i-1, y, colors.Outline)
-			im.Set(xr+i, y, colors.Outline)
-		}
-		for x := xl; x < xr; x++ {
-			im.Set(x, y, colors.Fill)
-		}
-	}
-
-	// shadow
-	for y := r.Dim - r.Padding; y < r.Dim; y++ {
-		for x := r.Padding; x < r.Dim-r.Padding; x++ {
-			im.Set(x, y, colors.Shadow)
-		}
-	}
-
-	r.centerLabel(im, colors.Text, label)
-
-	return im
-}
@@ -0,0 +1,92 @@
+package icon
+
+import (
+	"image/color"
+	"io/ioutil"
+	"testing"
+)
+
+// newTestRenderer returns a renderer using the fonts in ../res.
+func newTestRenderer(t *testing.T, fonts ...string) *Renderer {
+	t.Helper()
+	if len(fonts) == 0 {
+		fonts = []string{"Roboto-Medium.ttf"}
+	}
+	data := make([][]byte, len(fonts))
+	for i, name := range fonts {
+		var err error
+		data[i], err = ioutil.ReadFile("../res/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := NewRendererFonts(data...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestFade(t *testing.T) {
+	r := newTestRenderer(t)
+	colors := Colors{
+		Outline: color.NRGBA{0, 0, 0xff, 0xff},
+		Fill:    color.NRGBA{0xff, 0, 0, 0xff},
+		Shadow:  color.NRGBA{0, 0, 0, 73},
+		Text:    color.NRGBA{0, 0xff, 0, 0xff},
+	}
+	im := r.Render(Circle, colors, "8")
+	faded := Fade(im, 0.5)
+	if faded.Bounds() != im.Bounds() {
+		t.Fatalf("got bounds %v, want %v", faded.Bounds(), im.Bounds())
+	}
+
+	parts := []struct {
+		name string
+		c    color.NRGBA
+	}{
+		{"outline", colors.Outline.(color.NRGBA)},
+		{"fill", colors.Fill.(color.NRGBA)},
+		{"shadow", colors.Shadow.(color.NRGBA)},
+		{"label", colors.Text.(color.NRGBA)},
+	}
+	found := make([]int, len(parts))
+	b := im.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(im.At(x, y)).(color.NRGBA)
+			f := color.NRGBAModel.Convert(faded.At(x, y)).(color.NRGBA)
+			if d := int(f.A) - int(c.A)/2; d < -1 || d > 1 {
+				t.Fatalf("got alpha %d at %d,%d, want half of %d", f.A, x, y, c.A)
+			}
+			for i, p := range parts {
+				if c == p.c {
+					found[i]++
+					// faded color is the same, apart from rounding
+					if f.A == 0 || colorDiff(f.R, c.R) > 2 || colorDiff(f.G, c.G) > 2 || colorDiff(f.B, c.B) > 2 {
+						t.Errorf("%s at %d,%d: got %v, want %v with half alpha", p.name, x, y, f, c)
+					}
+				}
+			}
+		}
+	}
+	for i, p := range parts {
+		if found[i] == 0 {
+			t.Errorf("no %s pixels found", p.name)
+		}
+	}
+
+	if Fade(im, 1) != im {
+		t.Error("opacity 1 should return the image unchanged")
+	}
+	if _, _, _, a := Fade(im, -1).At(b.Dx()/2, b.Dy()/2).RGBA(); a != 0 {
+		t.Errorf("got alpha %d at negative opacity, want 0", a)
+	}
+}
+
+func colorDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
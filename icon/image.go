@@ -0,0 +1,138 @@
+package icon
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"sync"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Tint specifies how image shapes are colored with the fill color.
+type Tint int
+
+const (
+	// TintNone draws the image as is.
+	TintNone Tint = iota
+
+	// TintMultiply multiplies the image with the fill color,
+	// suitable for light or grayscale images.
+	TintMultiply
+
+	// TintMask fills the image silhouette with the fill color,
+	// suitable for single color pictograms.
+	TintMask
+)
+
+// imageIcon is a Drawable using a bitmap image as the icon background.
+type imageIcon struct {
+	src  image.Image
+	tint Tint
+
+	mu      sync.Mutex
+	scaled  map[image.Rectangle]*image.RGBA // src scaled to fit
+	pngData string                          // src as a data URL for vector output
+}
+
+// NewImageShape returns a Drawable drawing im scaled to fit the icon,
+// keeping its aspect ratio. The label is drawn over the image center.
+func NewImageShape(im image.Image, tint Tint) Drawable {
+	return &imageIcon{src: im, tint: tint}
+}
+
+func (s *imageIcon) Render(r *Renderer, colors Colors, label string) image.Image {
+	im := image.NewRGBA(image.Rect(0, 0, r.Dim, r.Dim))
+
+	src := s.image(r)
+	b := src.Bounds()
+	draw.DrawMask(im, b.Add(image.Pt(0, r.Padding)), image.NewUniform(colors.Shadow),
+		image.Point{}, src, b.Min, draw.Over)
+
+	switch s.tint {
+	case TintMultiply:
+		draw.Draw(im, b, multiply(src, colors.Fill), b.Min, draw.Over)
+	case TintMask:
+		draw.DrawMask(im, b, image.NewUniform(colors.Fill), image.Point{}, src, b.Min, draw.Over)
+	default:
+		draw.Draw(im, b, src, b.Min, draw.Over)
+	}
+
+	r.centerLabel(im, colors.Text, label)
+
+	return im
+}
+
+// image returns the source image scaled to fit within the padding of r.
+// Scaled images are cached, because they don't depend on colors or labels.
+func (s *imageIcon) image(r *Renderer) *image.RGBA {
+	dr := s.rect(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if im, ok := s.scaled[dr]; ok {
+		return im
+	}
+
+	im := image.NewRGBA(dr)
+	xdraw.CatmullRom.Scale(im, dr, s.src, s.src.Bounds(), draw.Src, nil)
+
+	if s.scaled == nil {
+		s.scaled = make(map[image.Rectangle]*image.RGBA)
+	}
+	s.scaled[dr] = im
+	return im
+}
+
+// rect returns the rectangle of the source image scaled to fit
+// within the padding of r, centered.
+func (s *imageIcon) rect(r *Renderer) image.Rectangle {
+	box := image.Rect(r.Padding, r.Padding, r.Dim-r.Padding, r.Dim-r.Padding)
+	sb := s.src.Bounds()
+
+	// fit src within box, centered
+	w, h := box.Dx(), box.Dy()
+	if sb.Dx()*h > sb.Dy()*w {
+		h = (sb.Dy()*w + sb.Dx()/2) / sb.Dx()
+	} else {
+		w = (sb.Dx()*h + sb.Dy()/2) / sb.Dy()
+	}
+	min := box.Min.Add(image.Pt((box.Dx()-w)/2, (box.Dy()-h)/2))
+	return image.Rectangle{min, min.Add(image.Pt(w, h))}
+}
+
+// dataURL returns the source image as a PNG data URL.
+func (s *imageIcon) dataURL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pngData == "" {
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, s.src); err != nil {
+			log.Println(err)
+			return ""
+		}
+		s.pngData = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+	return s.pngData
+}
+
+// multiply returns im with its channels multiplied by those of c.
+func multiply(im *image.RGBA, c color.Color) *image.RGBA {
+	cr, cg, cb, ca := c.RGBA()
+	dst := image.NewRGBA(im.Bounds())
+	for i := 0; i < len(im.Pix); i += 4 {
+		dst.Pix[i+0] = mulChannel(im.Pix[i+0], cr)
+		dst.Pix[i+1] = mulChannel(im.Pix[i+1], cg)
+		dst.Pix[i+2] = mulChannel(im.Pix[i+2], cb)
+		dst.Pix[i+3] = mulChannel(im.Pix[i+3], ca)
+	}
+	return dst
+}
+
+func mulChannel(v uint8, c uint32) uint8 {
+	return uint8((uint32(v)*c + 0x7fff) / 0xffff)
+}
@@ -0,0 +1,68 @@
+package icon
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func uniformImage(w, h int, c color.Color) *image.RGBA {
+	im := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(im, im.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return im
+}
+
+func TestImageRect(t *testing.T) {
+	r := newTestRenderer(t) // Dim 56, Padding 2
+	tests := []struct {
+		w, h int
+		want image.Rectangle
+	}{
+		{10, 10, image.Rect(2, 2, 54, 54)},
+		{100, 50, image.Rect(2, 15, 54, 41)},
+		{20, 40, image.Rect(15, 2, 41, 54)},
+		{500, 500, image.Rect(2, 2, 54, 54)},
+	}
+	for _, x := range tests {
+		s := NewImageShape(uniformImage(x.w, x.h, color.White), TintNone).(*imageIcon)
+		if got := s.rect(r); got != x.want {
+			t.Errorf("%dx%d: got %v, want %v", x.w, x.h, got, x.want)
+		}
+		if got := s.rect(r.WithDim(112)); got.Min != x.want.Min.Mul(2) {
+			t.Errorf("%dx%d at 2x: got %v, want %v", x.w, x.h, got, x.want.Min.Mul(2))
+		}
+	}
+}
+
+func TestImageTint(t *testing.T) {
+	r := newTestRenderer(t)
+	gray := color.RGBA{0x80, 0x80, 0x80, 0xff}
+	fill := color.RGBA{0xff, 0, 0x40, 0xff}
+	colors := Colors{Fill: fill, Shadow: color.Transparent, Text: color.White}
+
+	// a gray square with a transparent left half
+	src := uniformImage(20, 20, gray)
+	draw.Draw(src, image.Rect(0, 0, 10, 20), image.Transparent, image.Point{}, draw.Src)
+
+	tests := []struct {
+		tint Tint
+		want color.RGBA
+	}{
+		{TintNone, gray},
+		{TintMultiply, color.RGBA{0x80, 0, 0x20, 0xff}},
+		{TintMask, fill},
+	}
+	for _, x := range tests {
+		im := NewImageShape(src, x.tint).Render(r, colors, "")
+		if got := color.RGBAModel.Convert(im.At(40, 28)); got != x.want {
+			t.Errorf("tint %d: got %v in the image, want %v", x.tint, got, x.want)
+		}
+		if _, _, _, a := im.At(15, 28).RGBA(); a != 0 {
+			t.Errorf("tint %d: got alpha %d in the transparent part", x.tint, a)
+		}
+		if _, _, _, a := im.At(1, 28).RGBA(); a != 0 {
+			t.Errorf("tint %d: got alpha %d in the padding", x.tint, a)
+		}
+	}
+}
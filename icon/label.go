@@ -0,0 +1,227 @@
+package icon
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// capHeight is the approximate height of digits and capitals
+	// relative to the font size.
+	capHeight = 17.0 / 24
+
+	// lineSpacing is the distance of baselines in two line labels
+	// relative to the font size.
+	lineSpacing = 1.0
+
+	// minLabelSize is the smallest font size used for labels
+	// relative to the normal size.
+	minLabelSize = 0.5
+
+	ellipsis = "…"
+)
+
+// drawLabel draws label centered at center,
+// with its font size multiplied by scale.
+// The label is shrunk to fit the inner area of the shape,
+// and is drawn in two lines or truncated if it doesn't fit even so.
+func (r *Renderer) drawLabel(im draw.Image, textColor color.Color, label string,
+	center image.Point, scale float64) {
+	lines, size := r.placeLabel(label, center, scale)
+	if len(lines) == 0 {
+		return
+	}
+
+	c := freetype.NewContext()
+	c.SetSrc(image.NewUniform(textColor))
+	c.SetFontSize(size)
+	c.SetDst(im)
+	c.SetClip(im.Bounds())
+
+	for _, line := range lines {
+		pt := fixed.Point26_6{X: toFixed(line.x), Y: toFixed(line.y)}
+		for _, run := range r.textRuns(line.s) {
+			c.SetFont(run.font)
+			var err error
+			pt, err = c.DrawString(run.s, pt)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+		}
+	}
+}
+
+// labelLine is a line of a label placed within an icon.
+type labelLine struct {
+	s    string
+	x, y float64 // start of the baseline
+}
+
+// placeLabel returns the lines of label centered at center
+// and their font size, as drawn by drawLabel.
+func (r *Renderer) placeLabel(label string, center image.Point, scale float64) ([]labelLine, float64) {
+	if label == "" {
+		return nil, 0
+	}
+
+	var fs float64
+	if utf8.RuneCountInString(label) <= 2 {
+		fs = 30
+	} else {
+		fs = 24
+	}
+	fs = float64(r.Dim) * fs * scale / 56
+
+	inner := float64(r.Dim-2*(r.Padding+r.Stroke)) * scale
+	lines, size := r.layoutLabel(label, fs, 0.85*inner, 0.8*inner)
+
+	placed := make([]labelLine, len(lines))
+
+	// baseline of the first line
+	y := float64(center.Y) + (size*capHeight-float64(len(lines)-1)*size*lineSpacing)/2
+	for i, line := range lines {
+		x := float64(center.X) - r.textWidth(line, size)/2
+		placed[i] = labelLine{line, x, y}
+		y += size * lineSpacing
+	}
+	return placed, size
+}
+
+// layoutLabel returns the lines of label and the font size
+// to fit it within a box of width w and height h.
+// The font size is fs, or smaller if label doesn't fit.
+func (r *Renderer) layoutLabel(label string, fs, w, h float64) (lines []string, size float64) {
+	minfs := fs * minLabelSize
+
+	size = r.fitSize(fs, w, label)
+	if size >= minfs {
+		return []string{label}, size
+	}
+
+	if l1, l2, ok := splitLabel(label); ok {
+		size = r.fitSize(fs, w, l1, l2)
+		if hmax := h / (capHeight + lineSpacing); size > hmax {
+			size = hmax
+		}
+		if size >= minfs {
+			return []string{l1, l2}, size
+		}
+	}
+
+	// truncate with ellipsis at minimum size
+	runes := []rune(label)
+	for n := len(runes) - 1; n > 0; n-- {
+		s := strings.TrimSpace(string(runes[:n])) + ellipsis
+		if r.textWidth(s, minfs) <= w {
+			return []string{s}, minfs
+		}
+	}
+	return []string{ellipsis}, minfs
+}
+
+// fitSize returns the largest font size up to fs
+// that makes lines fit within width w.
+func (r *Renderer) fitSize(fs, w float64, lines ...string) float64 {
+	var lw float64
+	for _, l := range lines {
+		lw = math.Max(lw, r.textWidth(l, fs))
+	}
+	if lw <= w {
+		return fs
+	}
+	// text width is roughly proportional to font size
+	return fs * w / lw
+}
+
+// splitLabel splits label into two lines at the space closest to its middle.
+func splitLabel(label string) (l1, l2 string, ok bool) {
+	mid := len(label) / 2
+	best := -1
+	for i, c := range label {
+		if c == ' ' && (best < 0 || abs(i-mid) < abs(best-mid)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", "", false
+	}
+	l1 = strings.TrimSpace(label[:best])
+	l2 = strings.TrimSpace(label[best:])
+	return l1, l2, l1 != "" && l2 != ""
+}
+
+// textRun is a part of a text drawn with a single font.
+type textRun struct {
+	font *truetype.Font
+	s    string
+}
+
+// textRuns splits s into runs drawn with the first font
+// having glyphs for its characters.
+func (r *Renderer) textRuns(s string) []textRun {
+	var runs []textRun
+	start := 0
+	var font *truetype.Font
+	for i, c := range s {
+		f := r.fontFor(c)
+		if f != font && i > start {
+			runs = append(runs, textRun{font, s[start:i]})
+			start = i
+		}
+		font = f
+	}
+	if start < len(s) {
+		runs = append(runs, textRun{font, s[start:]})
+	}
+	return runs
+}
+
+// fontFor returns the first font having a glyph for c,
+// or the label font if none has.
+func (r *Renderer) fontFor(c rune) *truetype.Font {
+	for _, f := range r.fonts {
+		if f.Index(c) != 0 {
+			return f
+		}
+	}
+	return r.fonts[0]
+}
+
+// textWidth returns the advance width of s at font size fs in pixels.
+func (r *Renderer) textWidth(s string, fs float64) float64 {
+	scale := toFixed(fs)
+	var w fixed.Int26_6
+	for _, run := range r.textRuns(s) {
+		prev, hasPrev := truetype.Index(0), false
+		for _, c := range run.s {
+			i := run.font.Index(c)
+			if hasPrev {
+				w += run.font.Kern(scale, prev, i)
+			}
+			w += run.font.HMetric(scale, i).AdvanceWidth
+			prev, hasPrev = i, true
+		}
+	}
+	return float64(w) / 64
+}
+
+func toFixed(x float64) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(x * 64))
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
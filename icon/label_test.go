@@ -0,0 +1,150 @@
+package icon
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestTextRuns(t *testing.T) {
+	r := newTestRenderer(t)
+	goFont, err := ParseFont(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr, err := NewRendererTrueType(r.fonts[0], goFont)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roboto := r.fonts[0]
+
+	// Roboto has no glyph for Ǎ, but the Go font has.
+	// Neither has a glyph for the Hiragana あ.
+	tests := []struct {
+		s     string
+		fonts []string
+		runs  []string
+	}{
+		{"12", []string{"roboto"}, []string{"12"}},
+		{"Ǎ1", []string{"go", "roboto"}, []string{"Ǎ", "1"}},
+		{"1ǍǍ2", []string{"roboto", "go", "roboto"}, []string{"1", "ǍǍ", "2"}},
+		{"あ1", []string{"roboto"}, []string{"あ1"}},
+		{"", nil, nil},
+	}
+	name := map[interface{}]string{roboto: "roboto", goFont: "go"}
+	for _, x := range tests {
+		runs := fr.textRuns(x.s)
+		var fonts, strs []string
+		for _, run := range runs {
+			fonts = append(fonts, name[run.font])
+			strs = append(strs, run.s)
+		}
+		if !equalStrings(fonts, x.fonts) || !equalStrings(strs, x.runs) {
+			t.Errorf("%q: got runs %q with fonts %v, want %q with %v", x.s, strs, fonts, x.runs, x.fonts)
+		}
+	}
+
+	// without the fallback, missing glyphs use the label font
+	if runs := r.textRuns("Ǎ1"); len(runs) != 1 || runs[0].font != roboto {
+		t.Errorf("got %d runs without fallback, want 1 with the label font", len(runs))
+	}
+
+	// the fallback glyph has a width, unlike the missing glyph
+	if fr.textWidth("Ǎ", 24) == r.textWidth("Ǎ", 24) {
+		t.Error("fallback glyph measured like the missing glyph")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSplitLabel(t *testing.T) {
+	tests := []struct {
+		label  string
+		l1, l2 string
+		ok     bool
+	}{
+		{"Old Town Pub", "Old Town", "Pub", true},
+		{"The Old Pub", "The", "Old Pub", true},
+		{"A B", "A", "B", true},
+		{"Kocsma", "", "", false},
+		{" Kocsma", "", "", false},
+	}
+	for _, x := range tests {
+		l1, l2, ok := splitLabel(x.label)
+		if ok != x.ok || (ok && (l1 != x.l1 || l2 != x.l2)) {
+			t.Errorf("%q: got %q %q %v, want %q %q %v", x.label, l1, l2, ok, x.l1, x.l2, x.ok)
+		}
+	}
+}
+
+func TestLayoutLabel(t *testing.T) {
+	r := newTestRenderer(t)
+	const fs = 24.0
+	minfs := fs * minLabelSize
+
+	// fits as is
+	lines, size := r.layoutLabel("12", fs, 40, 40)
+	if len(lines) != 1 || lines[0] != "12" || size != fs {
+		t.Errorf("short label: got %q at %v, want one line at %v", lines, size, fs)
+	}
+
+	// shrunk to fit on one line
+	w := 0.8 * r.textWidth("123", fs)
+	lines, size = r.layoutLabel("123", fs, w, 40)
+	if len(lines) != 1 || size >= fs || size < minfs {
+		t.Errorf("wide label: got %q at %v", lines, size)
+	}
+	if lw := r.textWidth(lines[0], size); lw > w+0.5 {
+		t.Errorf("wide label: width %v exceeds %v", lw, w)
+	}
+
+	// two lines if one would be too small
+	w = 0.7 * r.textWidth("Old Town", fs)
+	lines, size = r.layoutLabel("Old Town Pub", fs, w, 100)
+	if len(lines) != 2 || lines[0] != "Old Town" || lines[1] != "Pub" || size < minfs {
+		t.Errorf("two lines: got %q at %v", lines, size)
+	}
+	for _, l := range lines {
+		if lw := r.textWidth(l, size); lw > w+0.5 {
+			t.Errorf("two lines: width of %q is %v, exceeds %v", l, lw, w)
+		}
+	}
+
+	// truncated if two lines don't fit the height
+	lines, size = r.layoutLabel("Old Town Pub", fs, w, minfs)
+	if len(lines) != 1 || size != minfs || !strings.HasSuffix(lines[0], ellipsis) {
+		t.Errorf("low box: got %q at %v, want truncated at %v", lines, size, minfs)
+	}
+
+	// truncated without spaces
+	lines, size = r.layoutLabel("1234567890123", fs, 30, 100)
+	if len(lines) != 1 || size != minfs || !strings.HasSuffix(lines[0], ellipsis) ||
+		!strings.HasPrefix("1234567890123", strings.TrimSuffix(lines[0], ellipsis)) {
+		t.Errorf("long label: got %q at %v, want truncated at %v", lines, size, minfs)
+	}
+	if lw := r.textWidth(lines[0], size); lw > 30 {
+		t.Errorf("long label: width %v exceeds 30", lw)
+	}
+}
+
+func TestPlaceLabelRunes(t *testing.T) {
+	r := newTestRenderer(t)
+	// font size depends on the number of characters, not bytes
+	_, s1 := r.placeLabel("Ü1", image.Pt(28, 28), 1)
+	_, s2 := r.placeLabel("U1", image.Pt(28, 28), 1)
+	if s1 != s2 {
+		t.Errorf("got size %v for Ü1, want %v like U1", s1, s2)
+	}
+}
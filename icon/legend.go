@@ -0,0 +1,78 @@
+package icon
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+
+	"github.com/golang/freetype"
+	"golang.org/x/image/math/fixed"
+)
+
+// LegendEntry is an icon with its description in a legend.
+type LegendEntry struct {
+	Icon image.Image
+	Text string
+}
+
+// Legend returns an image listing entries in rows
+// on a translucent white background.
+// The text size and spacing is relative to the icon size of r.
+func (r *Renderer) Legend(entries []LegendEntry) image.Image {
+	fs := float64(r.Dim) / 2
+	gap := int(math.Ceil(fs / 2))
+
+	var iconw, textw int
+	rowh := make([]int, len(entries))
+	for i, e := range entries {
+		b := e.Icon.Bounds()
+		if b.Dx() > iconw {
+			iconw = b.Dx()
+		}
+		if w := int(math.Ceil(r.textWidth(e.Text, fs))); w > textw {
+			textw = w
+		}
+		rowh[i] = b.Dy()
+		if h := int(math.Ceil(fs)); h > rowh[i] {
+			rowh[i] = h
+		}
+	}
+
+	h := gap
+	for _, rh := range rowh {
+		h += rh + gap
+	}
+	im := image.NewRGBA(image.Rect(0, 0, gap+iconw+gap+textw+gap, h))
+	draw.Draw(im, im.Bounds(), image.NewUniform(color.NRGBA{255, 255, 255, 0xd8}), image.Point{}, draw.Src)
+
+	c := freetype.NewContext()
+	c.SetSrc(image.Black)
+	c.SetFontSize(fs)
+	c.SetDst(im)
+	c.SetClip(im.Bounds())
+
+	y := gap
+	for i, e := range entries {
+		b := e.Icon.Bounds()
+		ip := image.Pt(gap+(iconw-b.Dx())/2, y+(rowh[i]-b.Dy())/2)
+		draw.Draw(im, b.Sub(b.Min).Add(ip), e.Icon, b.Min, draw.Over)
+
+		pt := fixed.Point26_6{
+			X: toFixed(float64(gap + iconw + gap)),
+			Y: toFixed(float64(y) + (float64(rowh[i])+fs*capHeight)/2),
+		}
+		for _, run := range r.textRuns(e.Text) {
+			c.SetFont(run.font)
+			var err error
+			pt, err = c.DrawString(run.s, pt)
+			if err != nil {
+				log.Println(err)
+				break
+			}
+		}
+		y += rowh[i] + gap
+	}
+	return im
+}
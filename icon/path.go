@@ -0,0 +1,484 @@
+package icon
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Path is a custom shape defined by SVG path data.
+type Path struct {
+	Data    string     // SVG path data, eg. "M 12 2 L 22 22 L 2 22 Z"
+	ViewBox [4]float64 // min x, min y, width and height
+
+	// EvenOdd selects the evenodd fill rule instead of nonzero.
+	EvenOdd bool
+
+	// Label is the label center in viewBox coordinates,
+	// nil means the center of the viewBox.
+	Label *[2]float64
+
+	// LabelScale is the font size relative to that of circles,
+	// zero means 1.
+	LabelScale float64
+
+	// Anchor is the anchor point in viewBox coordinates,
+	// nil means the bottom center of the icon.
+	Anchor *[2]float64
+}
+
+// NewPathShape returns a Drawable rendering p.
+// The viewBox is scaled to fit the icon, preserving its aspect ratio.
+func NewPathShape(p Path) (Drawable, error) {
+	vb := p.ViewBox
+	if vb[2] <= 0 || vb[3] <= 0 {
+		return nil, errors.New("invalid viewBox")
+	}
+
+	subpaths, outline, err := parsePathData(p.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(subpaths) == 0 {
+		return nil, errors.New("empty path")
+	}
+
+	// transform viewBox into the square from (-1, -1) to (1, 1)
+	scale := 2 / math.Max(vb[2], vb[3])
+	cx, cy := vb[0]+vb[2]/2, vb[1]+vb[3]/2
+	unit := func(x, y float64) [2]float64 {
+		return [2]float64{(x - cx) * scale, (y - cy) * scale}
+	}
+	for _, sp := range subpaths {
+		for i, v := range sp {
+			sp[i] = unit(v[0], v[1])
+		}
+	}
+
+	s := &shapeIcon{
+		dist: pathDist(subpaths, p.EvenOdd),
+		path: svgPath{
+			d:       outline,
+			origin:  [2]float64{cx, cy},
+			radius:  1 / scale,
+			evenOdd: p.EvenOdd,
+		},
+		labelScale: p.LabelScale,
+	}
+	if s.labelScale == 0 {
+		s.labelScale = 1
+	}
+	if p.Label != nil {
+		l := unit(p.Label[0], p.Label[1])
+		s.labelX, s.labelY = l[0], l[1]
+	}
+	if p.Anchor != nil {
+		a := unit(p.Anchor[0], p.Anchor[1])
+		return &anchoredShape{s, a[0], a[1]}, nil
+	}
+	return s, nil
+}
+
+// pathDist returns the signed distance function of the area
+// enclosed by subpaths using the specified fill rule.
+func pathDist(subpaths [][][2]float64, evenOdd bool) func(x, y float64) float64 {
+	return func(x, y float64) float64 {
+		d := math.Inf(1)
+		winding := 0
+		for _, v := range subpaths {
+			for i, j := 0, len(v)-1; i < len(v); j, i = i, i+1 {
+				ex, ey := v[j][0]-v[i][0], v[j][1]-v[i][1]
+				wx, wy := x-v[i][0], y-v[i][1]
+				if l := ex*ex + ey*ey; l > 0 {
+					t := clamp((wx*ex+wy*ey)/l, 0, 1)
+					d = math.Min(d, sq(wx-ex*t)+sq(wy-ey*t))
+				} else {
+					d = math.Min(d, wx*wx+wy*wy)
+				}
+
+				cross := ex*wy - ey*wx
+				switch {
+				case v[i][1] <= y && v[j][1] > y && cross > 0:
+					winding++
+				case v[i][1] > y && v[j][1] <= y && cross < 0:
+					winding--
+				}
+			}
+		}
+		inside := winding != 0
+		if evenOdd {
+			inside = winding%2 != 0
+		}
+		if inside {
+			return -math.Sqrt(d)
+		}
+		return math.Sqrt(d)
+	}
+}
+
+// parsePathData parses SVG path data into closed polygons,
+// flattening curves and arcs. It also returns the path data
+// using only absolute commands with all subpaths closed,
+// for vector output.
+func parsePathData(data string) ([][][2]float64, string, error) {
+	p := pathParser{src: data}
+	if err := p.parse(); err != nil {
+		return nil, "", errors.Wrapf(err, "path data at %d", p.pos)
+	}
+	p.endSubpath()
+	return p.subpaths, p.out.String(), nil
+}
+
+type pathParser struct {
+	src string
+	pos int
+
+	subpaths [][][2]float64
+	cur      [][2]float64
+
+	// out is the normalized path data of subpaths,
+	// and curOut is that of the current subpath
+	out, curOut strings.Builder
+
+	x, y   float64 // current point
+	sx, sy float64 // subpath start
+
+	// control point of the last curve command for S and T,
+	// relative to the current point
+	lastCtl  [2]float64
+	lastKind byte // 'C' or 'Q' if the last command was a curve
+}
+
+func (p *pathParser) parse() error {
+	var cmd byte
+	for {
+		p.skipSep()
+		if p.pos == len(p.src) {
+			return nil
+		}
+
+		if c := p.src[p.pos]; isPathCmd(c) {
+			cmd = c
+			p.pos++
+		} else if cmd == 0 {
+			return errors.Errorf("expected command, got %q", c)
+		}
+
+		rel := 'a' <= cmd && cmd <= 'z'
+		var ox, oy float64
+		if rel {
+			ox, oy = p.x, p.y
+		}
+
+		kind := byte(0)
+		switch cmd | 0x20 {
+		case 'z':
+			p.lineTo(p.sx, p.sy)
+			p.endSubpath()
+			p.x, p.y = p.sx, p.sy
+			cmd = 0
+		case 'm':
+			v, err := p.numbers(2)
+			if err != nil {
+				return err
+			}
+			p.endSubpath()
+			p.x, p.y = ox+v[0], oy+v[1]
+			p.sx, p.sy = p.x, p.y
+			p.cur = append(p.cur, [2]float64{p.x, p.y})
+			p.emit('M', p.x, p.y)
+			// subsequent pairs are implicit lineto commands
+			if rel {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		case 'l':
+			v, err := p.numbers(2)
+			if err != nil {
+				return err
+			}
+			p.lineTo(ox+v[0], oy+v[1])
+			p.emit('L', p.x, p.y)
+		case 'h':
+			v, err := p.numbers(1)
+			if err != nil {
+				return err
+			}
+			p.lineTo(ox+v[0], p.y)
+			p.emit('L', p.x, p.y)
+		case 'v':
+			v, err := p.numbers(1)
+			if err != nil {
+				return err
+			}
+			p.lineTo(p.x, oy+v[0])
+			p.emit('L', p.x, p.y)
+		case 'c', 's':
+			var c1x, c1y float64
+			var v []float64
+			var err error
+			if cmd|0x20 == 'c' {
+				v, err = p.numbers(6)
+				if err == nil {
+					c1x, c1y = ox+v[0], oy+v[1]
+					v = v[2:]
+				}
+			} else {
+				v, err = p.numbers(4)
+				c1x, c1y = p.reflectCtl('C')
+			}
+			if err != nil {
+				return err
+			}
+			c2x, c2y := ox+v[0], oy+v[1]
+			x, y := ox+v[2], oy+v[3]
+			p.cubicTo(c1x, c1y, c2x, c2y, x, y)
+			p.emit('C', c1x, c1y, c2x, c2y, x, y)
+			p.lastCtl = [2]float64{c2x - x, c2y - y}
+			kind = 'C'
+		case 'q', 't':
+			var cx, cy float64
+			var v []float64
+			var err error
+			if cmd|0x20 == 'q' {
+				v, err = p.numbers(4)
+				if err == nil {
+					cx, cy = ox+v[0], oy+v[1]
+					v = v[2:]
+				}
+			} else {
+				v, err = p.numbers(2)
+				cx, cy = p.reflectCtl('Q')
+			}
+			if err != nil {
+				return err
+			}
+			x, y := ox+v[0], oy+v[1]
+			p.quadTo(cx, cy, x, y)
+			p.emit('Q', cx, cy, x, y)
+			p.lastCtl = [2]float64{cx - x, cy - y}
+			kind = 'Q'
+		case 'a':
+			v, err := p.numbers(3)
+			if err != nil {
+				return err
+			}
+			large, err := p.flag()
+			if err != nil {
+				return err
+			}
+			sweep, err := p.flag()
+			if err != nil {
+				return err
+			}
+			e, err := p.numbers(2)
+			if err != nil {
+				return err
+			}
+			p.arcTo(v[0], v[1], v[2], large, sweep, ox+e[0], oy+e[1])
+			p.emit('A', v[0], v[1], v[2], flagValue(large), flagValue(sweep), p.x, p.y)
+		default:
+			return errors.Errorf("unknown command %q", cmd)
+		}
+		p.lastKind = kind
+	}
+}
+
+// reflectCtl returns the reflection of the last control point
+// if the last command was of kind, or the current point otherwise.
+func (p *pathParser) reflectCtl(kind byte) (float64, float64) {
+	if p.lastKind != kind {
+		return p.x, p.y
+	}
+	return p.x - p.lastCtl[0], p.y - p.lastCtl[1]
+}
+
+func (p *pathParser) endSubpath() {
+	if len(p.cur) > 2 {
+		p.subpaths = append(p.subpaths, p.cur)
+		p.out.WriteString(p.curOut.String())
+		p.out.WriteString("Z")
+	}
+	p.cur = nil
+	p.curOut.Reset()
+}
+
+// emit adds an absolute command to the normalized path data.
+func (p *pathParser) emit(cmd byte, v ...float64) {
+	p.curOut.WriteByte(cmd)
+	for i, x := range v {
+		if i != 0 {
+			p.curOut.WriteByte(' ')
+		}
+		p.curOut.WriteString(strconv.FormatFloat(x, 'g', -1, 64))
+	}
+}
+
+func flagValue(f bool) float64 {
+	if f {
+		return 1
+	}
+	return 0
+}
+
+func (p *pathParser) lineTo(x, y float64) {
+	if len(p.cur) == 0 {
+		p.cur = append(p.cur, [2]float64{p.x, p.y})
+		p.emit('M', p.x, p.y)
+	}
+	p.cur = append(p.cur, [2]float64{x, y})
+	p.x, p.y = x, y
+}
+
+const curveSegments = 16
+
+func (p *pathParser) cubicTo(c1x, c1y, c2x, c2y, x, y float64) {
+	x0, y0 := p.x, p.y
+	for i := 1; i <= curveSegments; i++ {
+		t := float64(i) / curveSegments
+		u := 1 - t
+		a, b, c, d := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+		p.lineTo(a*x0+b*c1x+c*c2x+d*x, a*y0+b*c1y+c*c2y+d*y)
+	}
+}
+
+func (p *pathParser) quadTo(cx, cy, x, y float64) {
+	x0, y0 := p.x, p.y
+	for i := 1; i <= curveSegments; i++ {
+		t := float64(i) / curveSegments
+		u := 1 - t
+		a, b, c := u*u, 2*u*t, t*t
+		p.lineTo(a*x0+b*cx+c*x, a*y0+b*cy+c*y)
+	}
+}
+
+// arcTo adds an elliptical arc using the SVG endpoint parametrization.
+func (p *pathParser) arcTo(rx, ry, rotDeg float64, large, sweep bool, x, y float64) {
+	x0, y0 := p.x, p.y
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || (x0 == x && y0 == y) {
+		p.lineTo(x, y)
+		return
+	}
+
+	phi := rotDeg * math.Pi / 180
+	sin, cos := math.Sincos(phi)
+
+	// SVG spec F.6.5: conversion to center parametrization
+	dx, dy := (x0-x)/2, (y0-y)/2
+	x1 := cos*dx + sin*dy
+	y1 := -sin*dx + cos*dy
+
+	if l := sq(x1)/sq(rx) + sq(y1)/sq(ry); l > 1 {
+		l = math.Sqrt(l)
+		rx, ry = rx*l, ry*l
+	}
+
+	num := sq(rx)*sq(ry) - sq(rx)*sq(y1) - sq(ry)*sq(x1)
+	den := sq(rx)*sq(y1) + sq(ry)*sq(x1)
+	k := math.Sqrt(math.Max(num, 0) / den)
+	if large == sweep {
+		k = -k
+	}
+	cx1 := k * rx * y1 / ry
+	cy1 := -k * ry * x1 / rx
+
+	cx := cos*cx1 - sin*cy1 + (x0+x)/2
+	cy := sin*cx1 + cos*cy1 + (y0+y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	t1 := angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	dt := angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && dt > 0 {
+		dt -= 2 * math.Pi
+	} else if sweep && dt < 0 {
+		dt += 2 * math.Pi
+	}
+
+	n := int(math.Ceil(math.Abs(dt) / (math.Pi / 16)))
+	for i := 1; i <= n; i++ {
+		t := t1 + dt*float64(i)/float64(n)
+		ex, ey := rx*math.Cos(t), ry*math.Sin(t)
+		if i == n {
+			p.lineTo(x, y)
+		} else {
+			p.lineTo(cos*ex-sin*ey+cx, sin*ex+cos*ey+cy)
+		}
+	}
+}
+
+func (p *pathParser) numbers(n int) ([]float64, error) {
+	v := make([]float64, n)
+	for i := range v {
+		p.skipSep()
+		start := p.pos
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		dot, exp := false, false
+	scan:
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			switch {
+			case '0' <= c && c <= '9':
+			case c == '.' && !dot && !exp:
+				dot = true
+			case (c == 'e' || c == 'E') && !exp && p.pos > start:
+				exp = true
+				if p.pos+1 < len(p.src) && (p.src[p.pos+1] == '+' || p.src[p.pos+1] == '-') {
+					p.pos++
+				}
+			default:
+				break scan
+			}
+			p.pos++
+		}
+		x, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			p.pos = start
+			return nil, errors.New("invalid number")
+		}
+		v[i] = x
+	}
+	return v, nil
+}
+
+// flag parses an arc flag, which may not be followed by a separator.
+func (p *pathParser) flag() (bool, error) {
+	p.skipSep()
+	if p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '0':
+			p.pos++
+			return false, nil
+		case '1':
+			p.pos++
+			return true, nil
+		}
+	}
+	return false, errors.New("invalid arc flag")
+}
+
+func (p *pathParser) skipSep() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\r', '\n', ',':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func isPathCmd(c byte) bool {
+	switch c | 0x20 {
+	case 'm', 'z', 'l', 'h', 'v', 'c', 's', 'q', 't', 'a':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package icon
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParsePathData(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // normalized path data
+	}{
+		// lines, absolute and relative
+		{"M 0 0 L 10 0 L 10 10 Z", "M0 0L10 0L10 10Z"},
+		{"m 0 0 l 10 0 l 0 10 z", "M0 0L10 0L10 10Z"},
+		{"M0 0H10V10Z", "M0 0L10 0L10 10Z"},
+		{"m0 0h10v10z", "M0 0L10 0L10 10Z"},
+		{"M0 0L10 0L10 10", "M0 0L10 0L10 10Z"},
+
+		// implicit lineto after moveto
+		{"M0 0 10 0 10 10z", "M0 0L10 0L10 10Z"},
+		{"m0 0 10 0 0 10z", "M0 0L10 0L10 10Z"},
+		{"M0 0 10 0 10 10z m20 0 10 0 0 10z", "M0 0L10 0L10 10ZM20 0L30 0L30 10Z"},
+
+		// number syntax
+		{"M.5.5L1e1,0 10-1z", "M0.5 0.5L10 0L10 -1Z"},
+
+		// cubic curves with control point reflection
+		{"M0 0C0 10 10 10 10 0Z", "M0 0C0 10 10 10 10 0Z"},
+		{"m0 0c0 10 10 10 10 0z", "M0 0C0 10 10 10 10 0Z"},
+		{"M0 0C0 10 10 10 10 0S20 -10 20 0Z", "M0 0C0 10 10 10 10 0C10 -10 20 -10 20 0Z"},
+		{"m0 0c0 10 10 10 10 0s10 -10 10 0z", "M0 0C0 10 10 10 10 0C10 -10 20 -10 20 0Z"},
+		{"M0 0S10 10 10 0Z", "M0 0C0 0 10 10 10 0Z"},
+		{"M0 0Q5 10 10 0S20 -10 20 0Z", "M0 0Q5 10 10 0C10 0 20 -10 20 0Z"},
+
+		// quadratic curves with control point reflection
+		{"M0 0Q5 10 10 0Z", "M0 0Q5 10 10 0Z"},
+		{"M0 0Q5 10 10 0T20 0Z", "M0 0Q5 10 10 0Q15 -10 20 0Z"},
+		{"m0 0q5 10 10 0t10 0z", "M0 0Q5 10 10 0Q15 -10 20 0Z"},
+		{"M0 0T10 0L5 5Z", "M0 0Q0 0 10 0L5 5Z"},
+
+		// arcs, with flags not followed by separators
+		{"M0 0A5 5 0 0 1 10 0Z", "M0 0A5 5 0 0 1 10 0Z"},
+		{"m0 0a5 5 0 0110 0z", "M0 0A5 5 0 0 1 10 0Z"},
+		{"M0 0A5 5 0 1 0 10 0Z", "M0 0A5 5 0 1 0 10 0Z"},
+	}
+
+	for _, x := range tests {
+		subpaths, got, err := parsePathData(x.src)
+		if err != nil {
+			t.Errorf("%q: %v", x.src, err)
+			continue
+		}
+		if got != x.want {
+			t.Errorf("%q: got %q, want %q", x.src, got, x.want)
+		}
+		if n := strings.Count(x.want, "Z"); len(subpaths) != n {
+			t.Errorf("%q: got %d subpaths, want %d", x.src, len(subpaths), n)
+		}
+	}
+}
+
+func TestParsePathDataErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"X 0 0", "path data at 0: expected command"},
+		{"M0 0L10", "path data at 7: invalid number"},
+		{"M0 0L1 x", "path data at 7: invalid number"},
+		{"M0 0L1 -", "path data at 7: invalid number"},
+		{"M0 0A5 5 0 2 0 10 0", "path data at 11: invalid arc flag"},
+		{"M0 0L10 0L10 10Z 5 5", "path data at 17: expected command"},
+	}
+
+	for _, x := range tests {
+		_, _, err := parsePathData(x.src)
+		if err == nil || !strings.HasPrefix(err.Error(), x.err) {
+			t.Errorf("%q: got error %v, want %q", x.src, err, x.err)
+		}
+	}
+}
+
+func TestPathArc(t *testing.T) {
+	for _, x := range []struct {
+		src  string
+		side float64 // sign of y of arc points
+	}{
+		{"M0 0A5 5 0 0 1 10 0", -1},
+		{"M0 0A5 5 0 0 0 10 0", 1},
+		{"M0 0A5 5 0 1 0 10 0", 1},
+		// radius too small, scaled up to fit
+		{"M0 0A1 1 0 0 1 10 0", -1},
+	} {
+		subpaths, _, err := parsePathData(x.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range subpaths[0][1:] {
+			if d := math.Hypot(v[0]-5, v[1]); math.Abs(d-5) > 1e-9 {
+				t.Errorf("%q: point %v at distance %v from center, want 5", x.src, v, d)
+			}
+			if v[1]*x.side < -1e-9 {
+				t.Errorf("%q: point %v on the wrong side", x.src, v)
+			}
+		}
+	}
+}
+
+func TestPathWinding(t *testing.T) {
+	const (
+		outer = "M0 0L10 0L10 10L0 10Z"
+		same  = "M3 3L7 3L7 7L3 7Z" // same direction as outer
+		rev   = "M3 3L3 7L7 7L7 3Z" // opposite direction
+	)
+
+	tests := []struct {
+		src     string
+		evenOdd bool
+		hole    bool
+	}{
+		{outer + same, false, false},
+		{outer + same, true, true},
+		{outer + rev, false, true},
+		{outer + rev, true, true},
+	}
+
+	for _, x := range tests {
+		subpaths, _, err := parsePathData(x.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dist := pathDist(subpaths, x.evenOdd)
+
+		if d := dist(1, 5); math.Abs(d+1) > 1e-9 {
+			t.Errorf("%q evenodd=%v: got distance %v in the ring, want -1", x.src, x.evenOdd, d)
+		}
+		if d := dist(20, 5); math.Abs(d-10) > 1e-9 {
+			t.Errorf("%q evenodd=%v: got distance %v outside, want 10", x.src, x.evenOdd, d)
+		}
+		want := -2.0
+		if x.hole {
+			want = 2
+		}
+		if d := dist(5, 5); math.Abs(d-want) > 1e-9 {
+			t.Errorf("%q evenodd=%v: got distance %v in the center, want %v", x.src, x.evenOdd, d, want)
+		}
+	}
+}
+
+func TestNewPathShapeErrors(t *testing.T) {
+	tests := []struct {
+		p   Path
+		err string
+	}{
+		{Path{Data: "M0 0L10 0L10 10Z"}, "invalid viewBox"},
+		{Path{Data: "M0 0L10 0", ViewBox: [4]float64{0, 0, 10, 10}}, "empty path"},
+		{Path{Data: "L", ViewBox: [4]float64{0, 0, 10, 10}}, "path data at 1"},
+	}
+	for _, x := range tests {
+		_, err := NewPathShape(x.p)
+		if err == nil || !strings.Contains(err.Error(), x.err) {
+			t.Errorf("%q: got error %v, want %q", x.p.Data, err, x.err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package icon
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"sort"
+)
+
+// MaxPaletteError is the largest difference of a color channel
+// of premultiplied 8-bit pixels accepted when quantizing images
+// to a palette in EncodePNG.
+const MaxPaletteError = 3
+
+// EncodePNG writes im to w in PNG format optimized for size.
+//
+// Icons have a few flat colors with antialiased edges,
+// so im is written with an 8-bit palette with alpha if it has
+// at most 256 colors, or if a palette approximates its pixels
+// within MaxPaletteError. Otherwise it is written in full color.
+// Each candidate is compressed at several levels,
+// and the smallest result is written.
+// Candidates failing to encode are skipped.
+func EncodePNG(w io.Writer, im image.Image) error {
+	candidates := []image.Image{im}
+	if p := quantize(im); p != nil {
+		candidates = append(candidates, p)
+	}
+
+	var best []byte
+	var err error
+	buf := new(bytes.Buffer)
+	for _, c := range candidates {
+		for _, level := range []png.CompressionLevel{png.DefaultCompression, png.BestCompression} {
+			buf.Reset()
+			enc := png.Encoder{CompressionLevel: level}
+			if err = enc.Encode(buf, c); err != nil {
+				continue
+			}
+			if best == nil || buf.Len() < len(best) {
+				best = append(best[:0], buf.Bytes()...)
+			}
+		}
+	}
+	if best == nil {
+		return err
+	}
+	_, err = w.Write(best)
+	return err
+}
+
+// rgba8 is a premultiplied 8-bit color.
+type rgba8 [4]uint8
+
+func (c rgba8) nrgba() color.NRGBA {
+	return color.NRGBAModel.Convert(color.RGBA{c[0], c[1], c[2], c[3]}).(color.NRGBA)
+}
+
+// colorCount is a color with the number of pixels having it.
+type colorCount struct {
+	c rgba8
+	n int
+}
+
+// quantize returns im as a paletted image, or nil
+// if it can't be represented within MaxPaletteError.
+//
+// Pixels are compared as they are read back from a PNG file,
+// that is after converting them to non-premultiplied colors.
+func quantize(im image.Image) *image.Paletted {
+	b := im.Bounds()
+	pix := make([]rgba8, 0, b.Dx()*b.Dy())
+	hist := make(map[rgba8]int)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			n := color.NRGBAModel.Convert(im.At(x, y)).(color.NRGBA)
+			r, g, b, a := n.RGBA()
+			c := rgba8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+			pix = append(pix, c)
+			hist[c]++
+		}
+	}
+
+	if len(hist) == 0 {
+		// empty image
+		return nil
+	}
+
+	colors := make([]colorCount, 0, len(hist))
+	for c, n := range hist {
+		colors = append(colors, colorCount{c, n})
+	}
+	// map iteration order is random, but the output should not be
+	sort.Slice(colors, func(i, j int) bool {
+		ci, cj := colors[i].c, colors[j].c
+		for k := range ci {
+			if ci[k] != cj[k] {
+				return ci[k] < cj[k]
+			}
+		}
+		return false
+	})
+
+	var palette []rgba8
+	if len(colors) <= 256 {
+		for _, cc := range colors {
+			palette = append(palette, cc.c)
+		}
+	} else {
+		palette = cutColors(colors, 256)
+	}
+
+	// palette entries are stored non-premultiplied
+	pal := make(color.Palette, len(palette))
+	for i, c := range palette {
+		n := c.nrgba()
+		pal[i] = n
+		r, g, b, a := n.RGBA()
+		palette[i] = rgba8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+	}
+
+	index := make(map[rgba8]uint8, len(colors))
+	for _, cc := range colors {
+		i := nearest(palette, cc.c)
+		if colorError(palette[i], cc.c) > MaxPaletteError {
+			return nil
+		}
+		index[cc.c] = uint8(i)
+	}
+
+	p := image.NewPaletted(b, pal)
+	for i, c := range pix {
+		p.Pix[i/b.Dx()*p.Stride+i%b.Dx()] = index[c]
+	}
+	return p
+}
+
+// cutColors returns at most n colors representing colors.
+//
+// Colors are split into boxes in the middle of the channel with the largest range,
+// always splitting the box with the largest range,
+// so the largest error within boxes is reduced first.
+// The colors returned are the averages of the boxes weighted by pixel counts.
+func cutColors(colors []colorCount, n int) []rgba8 {
+	boxes := [][]colorCount{colors}
+	for len(boxes) < n {
+		bi, ch, rng := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if c, r := widestChannel(box); r > rng {
+				bi, ch, rng = i, c, r
+			}
+		}
+		if bi < 0 {
+			break
+		}
+
+		box := boxes[bi]
+		sort.SliceStable(box, func(i, j int) bool {
+			return box[i].c[ch] < box[j].c[ch]
+		})
+		mid := (int(box[0].c[ch]) + int(box[len(box)-1].c[ch]) + 1) / 2
+		split := sort.Search(len(box), func(i int) bool {
+			return int(box[i].c[ch]) >= mid
+		})
+		boxes[bi] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	palette := make([]rgba8, len(boxes))
+	for i, box := range boxes {
+		var sum [4]int
+		var total int
+		for _, cc := range box {
+			for k, v := range cc.c {
+				sum[k] += int(v) * cc.n
+			}
+			total += cc.n
+		}
+		for k := range sum {
+			palette[i][k] = uint8((sum[k] + total/2) / total)
+		}
+		// premultiplied channels may not exceed alpha
+		for k := 0; k < 3; k++ {
+			if palette[i][k] > palette[i][3] {
+				palette[i][k] = palette[i][3]
+			}
+		}
+	}
+	return palette
+}
+
+// widestChannel returns the channel with the largest range in box.
+func widestChannel(box []colorCount) (ch, rng int) {
+	lo := box[0].c
+	hi := box[0].c
+	for _, cc := range box[1:] {
+		for k, v := range cc.c {
+			if v < lo[k] {
+				lo[k] = v
+			}
+			if v > hi[k] {
+				hi[k] = v
+			}
+		}
+	}
+	for k := range lo {
+		if r := int(hi[k]) - int(lo[k]); r > rng {
+			ch, rng = k, r
+		}
+	}
+	return ch, rng
+}
+
+// nearest returns the index of the palette color closest to c.
+func nearest(palette []rgba8, c rgba8) int {
+	best, bestDist := 0, -1
+	for i, p := range palette {
+		var d int
+		for k := range p {
+			v := int(p[k]) - int(c[k])
+			d += v * v
+		}
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// colorError returns the largest channel difference of a and b.
+func colorError(a, b rgba8) int {
+	var e int
+	for k := range a {
+		v := int(a[k]) - int(b[k])
+		if v < 0 {
+			v = -v
+		}
+		if v > e {
+			e = v
+		}
+	}
+	return e
+}
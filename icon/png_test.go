@@ -0,0 +1,213 @@
+package icon
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestEncodePNG(t *testing.T) {
+	shadow := Effect{Color: color.NRGBA{0, 0, 0, 0x88}, Radius: 2, Offset: image.Pt(1, 2)}
+	glow := Effect{Color: color.RGBA{0xff, 0xff, 0, 0xff}, Radius: 3}
+	tests := []struct {
+		d       Drawable
+		fill    color.Color
+		label   string
+		effects []Effect
+	}{
+		{Circle, color.RGBA{0xff, 0, 0, 0xff}, "1", []Effect{glow}},
+		{Circle, color.RGBA{0xff, 0, 0, 0xff}, "123", []Effect{glow}},
+		{Square, color.RGBA{0, 0, 0x80, 0xff}, "42", []Effect{shadow}},
+	}
+
+	r := newTestRenderer(t)
+	for _, tt := range tests {
+		for _, dim := range []int{28, 56, 84} {
+			effects := make([]Effect, len(tt.effects))
+			for i, e := range tt.effects {
+				effects[i] = e.Scaled(float64(dim) / 56)
+			}
+			im := r.WithDim(dim).RenderEffects(tt.d, SimpleColors(tt.fill), tt.label, effects)
+			buf := new(bytes.Buffer)
+			if err := EncodePNG(buf, im); err != nil {
+				t.Fatal(err)
+			}
+			dec, err := png.Decode(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := dec.(*image.Paletted); !ok {
+				t.Errorf("%s at %d: got %T, want paletted image", tt.label, dim, dec)
+			}
+			if e := maxPixelError(im, dec); e > MaxPaletteError {
+				t.Errorf("%s at %d: got error %d, want at most %d", tt.label, dim, e, MaxPaletteError)
+			}
+		}
+	}
+}
+
+func TestEncodePNGFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		im        image.Image
+		quantized bool
+	}{
+		{"gradient", gradientImage(512, 2), true},
+		{"random", randomImage(64, 64), false},
+	}
+
+	for _, tt := range tests {
+		if got := quantize(tt.im) != nil; got != tt.quantized {
+			t.Errorf("%s: got quantized %v, want %v", tt.name, got, tt.quantized)
+		}
+		buf := new(bytes.Buffer)
+		if err := EncodePNG(buf, tt.im); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		dec, err := png.Decode(buf)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if dec.Bounds() != tt.im.Bounds() {
+			t.Errorf("%s: got bounds %v, want %v", tt.name, dec.Bounds(), tt.im.Bounds())
+		}
+		if _, ok := dec.(*image.Paletted); ok && !tt.quantized {
+			t.Errorf("%s: got %T, want full color", tt.name, dec)
+		}
+		if e := maxPixelError(tt.im, dec); e > MaxPaletteError {
+			t.Errorf("%s: got error %d, want at most %d", tt.name, e, MaxPaletteError)
+		}
+	}
+}
+
+func TestQuantizeEmpty(t *testing.T) {
+	im := image.NewRGBA(image.Rect(0, 0, 0, 0))
+	if p := quantize(im); p != nil {
+		t.Errorf("got %d palette entries, want no paletted image", len(p.Palette))
+	}
+	// image/png rejects empty images, but not because of the palette
+	err := EncodePNG(new(bytes.Buffer), im)
+	if err == nil || strings.Contains(err.Error(), "palette") {
+		t.Errorf("got error %v, want invalid image size", err)
+	}
+}
+
+func TestCutColors(t *testing.T) {
+	r := newTestRenderer(t)
+	icon := r.WithDim(168).RenderEffects(Circle, SimpleColors(color.RGBA{0xff, 0, 0, 0xff}), "123",
+		[]Effect{{Color: color.NRGBA{0, 0, 0, 0x88}, Radius: 6, Offset: image.Pt(3, 6)}})
+
+	tests := []struct {
+		name   string
+		im     image.Image
+		n      int
+		maxErr int
+	}{
+		{"gradient", gradientImage(512, 2), 256, 1},
+		{"gradient 2d", gradientImage(64, 64), 256, 8},
+		{"icon", icon, 256, 8},
+		{"icon 16", icon, 16, 64},
+		{"random", randomImage(64, 64), 256, 128},
+	}
+
+	for _, tt := range tests {
+		colors := imageColors(tt.im)
+		if len(colors) <= tt.n {
+			t.Fatalf("%s: got %d colors, want more than %d", tt.name, len(colors), tt.n)
+		}
+		palette := cutColors(colors, tt.n)
+		if len(palette) != tt.n {
+			t.Errorf("%s: got %d palette entries, want %d", tt.name, len(palette), tt.n)
+		}
+		var maxErr int
+		for _, cc := range colors {
+			if e := colorError(palette[nearest(palette, cc.c)], cc.c); e > maxErr {
+				maxErr = e
+			}
+		}
+		if maxErr > tt.maxErr {
+			t.Errorf("%s: got error %d, want at most %d", tt.name, maxErr, tt.maxErr)
+		}
+		for _, c := range palette {
+			if c[0] > c[3] || c[1] > c[3] || c[2] > c[3] {
+				t.Errorf("%s: got %v, want premultiplied color", tt.name, c)
+			}
+		}
+	}
+}
+
+// imageColors returns the premultiplied 8-bit colors in im
+// as quantize collects them.
+func imageColors(im image.Image) []colorCount {
+	hist := make(map[rgba8]int)
+	b := im.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			n := color.NRGBAModel.Convert(im.At(x, y)).(color.NRGBA)
+			r, g, b, a := n.RGBA()
+			hist[rgba8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}]++
+		}
+	}
+	var colors []colorCount
+	for c, n := range hist {
+		colors = append(colors, colorCount{c, n})
+	}
+	return colors
+}
+
+// gradientImage returns an opaque image with red changing along x
+// and green along y, having more than 256 colors if w*h > 256.
+func gradientImage(w, h int) image.Image {
+	im := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			im.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 0x80, 0xff})
+		}
+	}
+	return im
+}
+
+// randomImage returns an opaque image with random pixels.
+func randomImage(w, h int) image.Image {
+	rnd := rand.New(rand.NewSource(1))
+	im := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(im.Pix); i += 4 {
+		im.Pix[i] = uint8(rnd.Intn(256))
+		im.Pix[i+1] = uint8(rnd.Intn(256))
+		im.Pix[i+2] = uint8(rnd.Intn(256))
+		im.Pix[i+3] = 0xff
+	}
+	return im
+}
+
+// maxPixelError returns the largest difference of premultiplied 8-bit color channels
+// in a and b.
+func maxPixelError(a, b image.Image) int {
+	var e int
+	ab, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			ac := color.NRGBAModel.Convert(a.At(ab.Min.X+x, ab.Min.Y+y))
+			r0, g0, b0, a0 := ac.RGBA()
+			r1, g1, b1, a1 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			for _, d := range []int{
+				int(r0>>8) - int(r1>>8), int(g0>>8) - int(g1>>8),
+				int(b0>>8) - int(b1>>8), int(a0>>8) - int(a1>>8),
+			} {
+				if d < 0 {
+					d = -d
+				}
+				if d > e {
+					e = d
+				}
+			}
+		}
+	}
+	return e
+}
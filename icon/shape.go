@@ -0,0 +1,290 @@
+package icon
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sync"
+)
+
+// Anchored is implemented by Drawables having an anchor point
+// other than the bottom center of the icon, such as a map pin.
+type Anchored interface {
+	// Anchor returns the anchor point of the icon rendered by r.
+	Anchor(r *Renderer) image.Point
+}
+
+// Anchor returns the anchor point of d in the image
+// from RenderEffects, that is including the margin of r,
+// or false if d has no specific anchor.
+func (r *Renderer) Anchor(d Drawable) (image.Point, bool) {
+	a, ok := d.(Anchored)
+	if !ok {
+		return image.Point{}, false
+	}
+	return a.Anchor(r).Add(image.Pt(r.Margin, r.Margin)), true
+}
+
+// shapeIcon is a Drawable defined by a signed distance function.
+type shapeIcon struct {
+	// dist returns the signed distance of (x, y) from the edge,
+	// negative inside, for the shape fitting in the square
+	// from (-1, -1) to (1, 1).
+	dist func(x, y float64) float64
+
+	// path is the outline of the shape for vector output.
+	path svgPath
+
+	// labelX and labelY are the offset of the label center
+	// relative to the icon center, in units of the shape radius.
+	labelX, labelY float64
+
+	// labelScale is the font size relative to that of circles.
+	labelScale float64
+
+	mu    sync.Mutex
+	masks map[maskKey]*image.Alpha // coverage masks
+}
+
+type maskKey struct {
+	dim                   int
+	cx, cy, radius, inset float64
+}
+
+var (
+	Circle        Drawable = &shapeIcon{dist: circleDist, path: circlePath, labelScale: 1}
+	Square        Drawable = &shapeIcon{dist: squareDist, path: squarePath, labelScale: 1}
+	Diamond       Drawable = polygonShape(diamondVertices, 0, 0.8)
+	Hexagon       Drawable = polygonShape(regularPolygon(6, 0), 0, 0.9)
+	Star          Drawable = polygonShape(starVertices(5, 0.55), 0.08, 0.6)
+	Triangle      Drawable = polygonShape(triangleVertices, 0.3, 0.7)
+	RoundedSquare Drawable = &shapeIcon{dist: roundedSquareDist(0.35), path: roundedSquarePath(0.35), labelScale: 1}
+	Pin           Drawable = &anchoredShape{&shapeIcon{dist: polygonDist(pinVertices()), path: pinPath(), labelY: pinHeadY, labelScale: 0.75}, 0, 1}
+)
+
+// polygonShape returns a shape with vertices v and the label
+// at labelY below the center with labelScale.
+func polygonShape(v [][2]float64, labelY, labelScale float64) *shapeIcon {
+	return &shapeIcon{
+		dist:       polygonDist(v),
+		path:       polygonPath(v),
+		labelY:     labelY,
+		labelScale: labelScale,
+	}
+}
+
+func (s *shapeIcon) Render(r *Renderer, colors Colors, label string) image.Image {
+	center := float64(r.Dim) / 2
+	radius := center - float64(r.Padding)
+	im := image.NewRGBA(image.Rect(0, 0, r.Dim, r.Dim))
+
+	s.fill(im, colors.Shadow, center, center+float64(r.Padding), radius, 0)
+	if r.Stroke > 0 {
+		s.fill(im, colors.Outline, center, center, radius, 0)
+	}
+	s.fill(im, colors.Fill, center, center, radius, float64(r.Stroke))
+
+	lc := image.Pt(int(center+s.labelX*radius+0.5), int(center+s.labelY*radius+0.5))
+	r.drawLabel(im, colors.Text, label, lc, s.labelScale)
+
+	return im
+}
+
+// fill draws the shape centered at (cx, cy) with the given radius
+// over im, shrunk by inset pixels along its edge.
+func (s *shapeIcon) fill(im *image.RGBA, c color.Color, cx, cy, radius, inset float64) {
+	b := im.Bounds()
+	mask := s.mask(b, cx, cy, radius, inset)
+	draw.DrawMask(im, b, image.NewUniform(c), image.Point{}, mask, b.Min, draw.Over)
+}
+
+// mask returns the coverage mask of the shape.
+// Masks are cached, because they don't depend on colors or labels.
+func (s *shapeIcon) mask(b image.Rectangle, cx, cy, radius, inset float64) *image.Alpha {
+	k := maskKey{b.Dx(), cx, cy, radius, inset}
+	s.mu.Lock()
+	m, ok := s.masks[k]
+	s.mu.Unlock()
+	if ok && m.Bounds() == b {
+		return m
+	}
+
+	// computed without holding the lock, so icons
+	// of other sizes may be rendered meanwhile
+	mask := coverage(b, func(x, y float64) float64 {
+		return s.dist((x-cx)/radius, (y-cy)/radius)*radius + inset
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.masks == nil {
+		s.masks = make(map[maskKey]*image.Alpha)
+	}
+	s.masks[k] = mask
+	return mask
+}
+
+// supersample is the number of samples per pixel
+// in both directions along shape edges.
+const supersample = 4
+
+// coverage returns the coverage mask of a shape within b
+// with the signed distance function dist in pixels.
+//
+// Pixels far from the edge are fully covered or empty.
+// Pixels near the edge are supersampled, with each sample
+// having a linear coverage estimated from its distance.
+// This keeps straight edges smooth, and corners and thin parts accurate.
+func coverage(b image.Rectangle, dist func(x, y float64) float64) *image.Alpha {
+	mask := image.NewAlpha(b)
+	const n = supersample
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			d := dist(float64(x)+0.5, float64(y)+0.5)
+			var v float64
+			switch {
+			case d <= -1:
+				v = 1
+			case d >= 1:
+				continue
+			default:
+				for sy := 0; sy < n; sy++ {
+					fy := float64(y) + (float64(sy)+0.5)/n
+					for sx := 0; sx < n; sx++ {
+						fx := float64(x) + (float64(sx)+0.5)/n
+						v += clamp(0.5-dist(fx, fy)*n, 0, 1)
+					}
+				}
+				v /= n * n
+			}
+			mask.SetAlpha(x, y, color.Alpha{uint8(v*0xff + 0.5)})
+		}
+	}
+	return mask
+}
+
+// anchoredShape is a shape with an anchor point,
+// such as a map pin anchored at its tip.
+type anchoredShape struct {
+	*shapeIcon
+
+	// anchor relative to the icon center, in units of the shape radius
+	ax, ay float64
+}
+
+func (s *anchoredShape) Anchor(r *Renderer) image.Point {
+	center := float64(r.Dim) / 2
+	radius := center - float64(r.Padding)
+	return image.Pt(int(center+s.ax*radius+0.5), int(center+s.ay*radius+0.5))
+}
+
+// pinHeadY is the center of the round head of the pin,
+// and pinHeadRadius is its radius, in units of the shape radius.
+const (
+	pinHeadRadius = 0.68
+	pinHeadY      = -1 + pinHeadRadius
+)
+
+// pinVertices returns the pin outline with the tip at (0, 1).
+func pinVertices() [][2]float64 {
+	// the sides of the pin are tangents from the tip to the head
+	d := 1 - pinHeadY
+	a := math.Asin(pinHeadRadius / d)
+
+	// angle of the tangent points on the head, measured from the top
+	t := math.Pi - (math.Pi/2 - a)
+
+	const n = 48
+	v := [][2]float64{{0, 1}}
+	for i := 0; i <= n; i++ {
+		phi := -t + 2*t*float64(i)/n
+		v = append(v, [2]float64{
+			pinHeadRadius * math.Sin(phi),
+			pinHeadY - pinHeadRadius*math.Cos(phi),
+		})
+	}
+	return v
+}
+
+func circleDist(x, y float64) float64 {
+	return math.Hypot(x, y) - 1
+}
+
+func squareDist(x, y float64) float64 {
+	qx, qy := math.Abs(x)-1, math.Abs(y)-1
+	return math.Hypot(math.Max(qx, 0), math.Max(qy, 0)) + math.Min(math.Max(qx, qy), 0)
+}
+
+var diamondVertices = [][2]float64{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+
+var triangleVertices = [][2]float64{{0, -1}, {1, 0.85}, {-1, 0.85}}
+
+// regularPolygon returns the vertices of a regular polygon with n sides
+// inscribed in the unit circle, rotated by rot radians.
+func regularPolygon(n int, rot float64) [][2]float64 {
+	v := make([][2]float64, n)
+	for i := range v {
+		a := rot + 2*math.Pi*float64(i)/float64(n)
+		v[i] = [2]float64{math.Sin(a), -math.Cos(a)}
+	}
+	return v
+}
+
+// starVertices returns a star with n points with its inner vertices
+// at the given fraction of the outer radius.
+func starVertices(n int, inner float64) [][2]float64 {
+	v := make([][2]float64, 2*n)
+	for i := range v {
+		a := math.Pi * float64(i) / float64(n)
+		r := 1.0
+		if i%2 == 1 {
+			r = inner
+		}
+		v[i] = [2]float64{r * math.Sin(a), -r * math.Cos(a)}
+	}
+	return v
+}
+
+// polygonDist returns the signed distance function of a simple polygon.
+func polygonDist(v [][2]float64) func(x, y float64) float64 {
+	return func(x, y float64) float64 {
+		d := sq(x-v[0][0]) + sq(y-v[0][1])
+		inside := false
+		for i, j := 0, len(v)-1; i < len(v); j, i = i, i+1 {
+			ex, ey := v[j][0]-v[i][0], v[j][1]-v[i][1]
+			wx, wy := x-v[i][0], y-v[i][1]
+			t := clamp((wx*ex+wy*ey)/(ex*ex+ey*ey), 0, 1)
+			d = math.Min(d, sq(wx-ex*t)+sq(wy-ey*t))
+
+			// crossing number test
+			if (v[i][1] > y) != (v[j][1] > y) &&
+				x < v[i][0]+(y-v[i][1])*ex/ey {
+				inside = !inside
+			}
+		}
+		if inside {
+			return -math.Sqrt(d)
+		}
+		return math.Sqrt(d)
+	}
+}
+
+// roundedSquareDist returns the signed distance function
+// of a square with corners rounded with radius rc.
+func roundedSquareDist(rc float64) func(x, y float64) float64 {
+	return func(x, y float64) float64 {
+		qx := math.Abs(x) - (1 - rc)
+		qy := math.Abs(y) - (1 - rc)
+		outside := math.Hypot(math.Max(qx, 0), math.Max(qy, 0))
+		return outside + math.Min(math.Max(qx, qy), 0) - rc
+	}
+}
+
+func sq(x float64) float64 {
+	return x * x
+}
+
+func clamp(x, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(x, hi))
+}
@@ -0,0 +1,66 @@
+package icon
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestCoverageEdge(t *testing.T) {
+	b := image.Rect(0, 0, 20, 4)
+	tests := []struct {
+		edge float64
+		want []uint8 // coverage of pixels 8 to 11
+	}{
+		{10, []uint8{255, 255, 0, 0}},
+		{10.5, []uint8{255, 255, 128, 0}},
+		{10.25, []uint8{255, 255, 64, 0}},
+		{9.75, []uint8{255, 191, 0, 0}},
+	}
+	for _, x := range tests {
+		mask := coverage(b, func(px, py float64) float64 {
+			return px - x.edge
+		})
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for i, want := range x.want {
+				if got := mask.AlphaAt(8+i, y).A; got != want {
+					t.Errorf("edge at %v: got %d at %d,%d, want %d", x.edge, got, 8+i, y, want)
+				}
+			}
+			if got := mask.AlphaAt(0, y).A; got != 255 {
+				t.Errorf("edge at %v: got %d far inside", x.edge, got)
+			}
+			if got := mask.AlphaAt(19, y).A; got != 0 {
+				t.Errorf("edge at %v: got %d far outside", x.edge, got)
+			}
+		}
+	}
+}
+
+func TestCoverageArea(t *testing.T) {
+	const cx, cy, radius = 20.3, 19.6, 15.2
+	b := image.Rect(0, 0, 40, 40)
+	mask := coverage(b, func(x, y float64) float64 {
+		return circleDist((x-cx)/radius, (y-cy)/radius) * radius
+	})
+
+	var area float64
+	for _, a := range mask.Pix {
+		area += float64(a) / 255
+	}
+	if want := math.Pi * radius * radius; math.Abs(area-want) > want*0.002 {
+		t.Errorf("got area %v, want %v", area, want)
+	}
+
+	// coverage decreases going outwards across the edge
+	for y := 0; y < 40; y++ {
+		prev := uint8(255)
+		for x := 21; x < 40; x++ {
+			a := mask.AlphaAt(x, y).A
+			if a > prev {
+				t.Errorf("coverage increases at %d,%d", x, y)
+			}
+			prev = a
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package icon
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/pkg/errors"
+	"golang.org/x/image/font"
+)
+
+// SVGIcon is an icon with everything drawn in it, for vector output.
+type SVGIcon struct {
+	Shape   Drawable
+	Colors  Colors
+	Label   string
+	Effects []Effect // drawn behind the icon, like with RenderEffects
+	Badges  []Badge  // drawn over the icon, like with AddBadges
+	Opacity float64  // opacity of the whole icon like with Fade, 1 is opaque
+}
+
+// vector is implemented by Drawables that can be rendered as SVG.
+type vector interface {
+	renderSVG(w *svgWriter, r *Renderer, colors Colors, label string)
+}
+
+// RenderSVG returns ic drawn like the raster output of r as an SVG document
+// with its width and height being size CSS pixels.
+// The document includes the margin of r around the icon, like RenderEffects.
+// Labels are embedded as glyph outlines, so the document doesn't depend on fonts.
+func (r *Renderer) RenderSVG(ic SVGIcon, size float64) ([]byte, error) {
+	v, ok := ic.Shape.(vector)
+	if !ok {
+		return nil, errors.New("shape has no vector form")
+	}
+
+	w := new(svgWriter)
+	if ic.Opacity < 1 {
+		w.printf(`<g opacity="%s">`, num(math.Max(ic.Opacity, 0)))
+	}
+	if len(ic.Effects) != 0 {
+		w.printf(`<g filter="url(#%s)">`, w.effectFilter(r.Dim, r.Margin, ic.Effects))
+	}
+	v.renderSVG(w, r, ic.Colors, ic.Label)
+	if len(ic.Effects) != 0 {
+		w.printf(`</g>`)
+	}
+	r.badgesSVG(w, ic.Badges)
+	if ic.Opacity < 1 {
+		w.printf(`</g>`)
+	}
+	return w.document(r.Dim, r.Margin, size), nil
+}
+
+func (s *shapeIcon) renderSVG(w *svgWriter, r *Renderer, colors Colors, label string) {
+	center := float64(r.Dim) / 2
+	radius := center - float64(r.Padding)
+
+	id, unit := s.defineSVG(w, center, center, radius)
+	w.printf(`<use xlink:href="#%s" transform="translate(0 %d)" %s/>`,
+		id, r.Padding, paint("fill", colors.Shadow))
+	w.fillShape(id, unit, colors.Fill, colors.Outline, float64(r.Stroke))
+
+	lc := image.Pt(int(center+s.labelX*radius+0.5), int(center+s.labelY*radius+0.5))
+	r.labelSVG(w, colors.Text, label, lc, s.labelScale)
+}
+
+// defineSVG adds the outline of the shape centered at (cx, cy)
+// with the given radius to the definitions of w.
+// It returns the id of the outline and the size of its path units in pixels.
+func (s *shapeIcon) defineSVG(w *svgWriter, cx, cy, radius float64) (id string, unit float64) {
+	p := s.path
+	unit = radius
+	if p.radius != 0 {
+		unit /= p.radius
+	}
+
+	transform := fmt.Sprintf("translate(%s %s) scale(%s)", num(cx), num(cy), num(unit))
+	if p.origin != [2]float64{} {
+		transform += fmt.Sprintf(" translate(%s %s)", num(-p.origin[0]), num(-p.origin[1]))
+	}
+	var rule string
+	if p.evenOdd {
+		rule = ` fill-rule="evenodd" clip-rule="evenodd"`
+	}
+
+	id = w.id()
+	w.def(`<path id="%s" d="%s" transform="%s"%s/>`, id, xmlEscape(p.d), transform, rule)
+	return id, unit
+}
+
+func (s *imageIcon) renderSVG(w *svgWriter, r *Renderer, colors Colors, label string) {
+	b := s.rect(r)
+	id := w.id()
+	w.def(`<image id="%s" x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="none" xlink:href="%s"/>`,
+		id, b.Min.X, b.Min.Y, b.Dx(), b.Dy(), s.dataURL())
+
+	w.printf(`<use xlink:href="#%s" transform="translate(0 %d)" filter="url(#%s)"/>`,
+		id, r.Padding, w.tintFilter(colors.Shadow, TintMask))
+	if s.tint == TintNone {
+		w.printf(`<use xlink:href="#%s"/>`, id)
+	} else {
+		w.printf(`<use xlink:href="#%s" filter="url(#%s)"/>`, id, w.tintFilter(colors.Fill, s.tint))
+	}
+
+	center := r.Dim / 2
+	r.labelSVG(w, colors.Text, label, image.Pt(center, center), 1)
+}
+
+// badgesSVG draws badges like AddBadges.
+func (r *Renderer) badgesSVG(w *svgWriter, badges []Badge) {
+	radius := float64(r.Dim) * 0.16
+	stroke := math.Max(1, float64(r.Stroke)*0.75)
+
+	var stack [4]int
+	for _, bg := range badges {
+		cx, cy := r.badgeCenter(bg.Corner, radius, stack[bg.Corner])
+		stack[bg.Corner]++
+
+		id, unit := badgeShape(bg.Mark).defineSVG(w, cx, cy, radius)
+		if bg.Outline != nil {
+			w.fillShape(id, unit, bg.Color, bg.Outline, stroke)
+		} else {
+			w.fillShape(id, unit, bg.Color, nil, 0)
+		}
+
+		if bg.Mark == LetterMark && bg.Letter != "" {
+			c := image.Pt(int(cx+0.5), int(cy+0.5))
+			r.labelSVG(w, bg.Text, bg.Letter, c, 2.5*radius/float64(r.Dim))
+		}
+	}
+}
+
+// labelSVG draws label like drawLabel, using glyph outlines.
+func (r *Renderer) labelSVG(w *svgWriter, textColor color.Color, label string,
+	center image.Point, scale float64) {
+	lines, size := r.placeLabel(label, center, scale)
+	if len(lines) == 0 {
+		return
+	}
+
+	fsize := toFixed(size)
+	var d strings.Builder
+	var g truetype.GlyphBuf
+	for _, line := range lines {
+		x := line.x
+		for _, run := range r.textRuns(line.s) {
+			prev, hasPrev := truetype.Index(0), false
+			for _, c := range run.s {
+				i := run.font.Index(c)
+				if hasPrev {
+					x += float64(run.font.Kern(fsize, prev, i)) / 64
+				}
+				if err := g.Load(run.font, fsize, i, font.HintingNone); err != nil {
+					log.Println(err)
+					return
+				}
+				glyphPath(&d, &g, x, line.y)
+				x += float64(run.font.HMetric(fsize, i).AdvanceWidth) / 64
+				prev, hasPrev = i, true
+			}
+		}
+	}
+	if d.Len() != 0 {
+		w.printf(`<path d="%s" %s/>`, d.String(), paint("fill", textColor))
+	}
+}
+
+// glyphPath appends the outline of g to d with its origin at (x, y).
+func glyphPath(d *strings.Builder, g *truetype.GlyphBuf, x, y float64) {
+	pt := func(p truetype.Point) [2]float64 {
+		return [2]float64{x + float64(p.X)/64, y - float64(p.Y)/64}
+	}
+	onCurve := func(p truetype.Point) bool {
+		return p.Flags&0x01 != 0
+	}
+	mid := func(a, b [2]float64) [2]float64 {
+		return [2]float64{(a[0] + b[0]) / 2, (a[1] + b[1]) / 2}
+	}
+
+	start := 0
+	for _, end := range g.Ends {
+		contour := g.Points[start:end]
+		start = end
+		if len(contour) == 0 {
+			continue
+		}
+
+		// start at the first on curve point, or between the last
+		// and the first point if all are off curve control points
+		n := len(contour)
+		first := 0
+		for first < n && !onCurve(contour[first]) {
+			first++
+		}
+		var p0 [2]float64
+		if first == n {
+			first = 0
+			p0 = mid(pt(contour[n-1]), pt(contour[0]))
+		} else {
+			p0 = pt(contour[first])
+			first++
+			n--
+		}
+		fmt.Fprintf(d, "M%s %s", num(p0[0]), num(p0[1]))
+
+		var ctl [2]float64
+		hasCtl := false
+		for k := 0; k < n; k++ {
+			p := contour[(first+k)%len(contour)]
+			q := pt(p)
+			switch {
+			case onCurve(p) && hasCtl:
+				fmt.Fprintf(d, "Q%s %s %s %s", num(ctl[0]), num(ctl[1]), num(q[0]), num(q[1]))
+				hasCtl = false
+			case onCurve(p):
+				fmt.Fprintf(d, "L%s %s", num(q[0]), num(q[1]))
+			case hasCtl:
+				// implied on curve point between control points
+				m := mid(ctl, q)
+				fmt.Fprintf(d, "Q%s %s %s %s", num(ctl[0]), num(ctl[1]), num(m[0]), num(m[1]))
+				ctl = q
+			default:
+				ctl, hasCtl = q, true
+			}
+		}
+		if hasCtl {
+			fmt.Fprintf(d, "Q%s %s %s %s", num(ctl[0]), num(ctl[1]), num(p0[0]), num(p0[1]))
+		}
+		d.WriteString("Z")
+	}
+}
+
+// svgPath is the outline of a shape for vector output.
+type svgPath struct {
+	d       string     // SVG path data
+	origin  [2]float64 // shape center in path coordinates
+	radius  float64    // shape radius in path units, zero means 1
+	evenOdd bool       // evenodd fill rule
+}
+
+var (
+	circlePath = svgPath{d: "M-1 0A1 1 0 0 1 1 0A1 1 0 0 1-1 0Z"}
+	squarePath = svgPath{d: "M-1-1H1V1H-1Z"}
+)
+
+// polygonPath returns the outline of a polygon with vertices v.
+func polygonPath(v [][2]float64) svgPath {
+	var d strings.Builder
+	for i, p := range v {
+		if i == 0 {
+			d.WriteString("M")
+		} else {
+			d.WriteString("L")
+		}
+		fmt.Fprintf(&d, "%s %s", num(p[0]), num(p[1]))
+	}
+	d.WriteString("Z")
+	return svgPath{d: d.String()}
+}
+
+// roundedSquarePath returns the outline of a square
+// with corners rounded with radius rc.
+func roundedSquarePath(rc float64) svgPath {
+	q, r := num(1-rc), num(rc)
+	arc := "A" + r + " " + r + " 0 0 1 "
+	return svgPath{d: "M-" + q + " -1H" + q + arc + "1 -" + q +
+		"V" + q + arc + q + " 1" +
+		"H-" + q + arc + "-1 " + q +
+		"V-" + q + arc + "-" + q + " -1Z"}
+}
+
+// pinPath returns the outline of Pin, with an exact round head.
+func pinPath() svgPath {
+	v := pinVertices()
+	left, right := v[1], v[len(v)-1]
+	r := num(pinHeadRadius)
+	return svgPath{d: fmt.Sprintf("M0 1L%s %sA%s %s 0 1 1 %s %sZ",
+		num(left[0]), num(left[1]), r, r, num(right[0]), num(right[1]))}
+}
+
+// crossPath returns the outline of the shape of crossDist.
+func crossPath(arm, w float64) svgPath {
+	// concave corners are on the axes, and the arms end in half circles
+	c := w * math.Sqrt2
+	o := w / math.Sqrt2
+	rotate := func(x, y float64, quarter int) (float64, float64) {
+		for i := 0; i < quarter; i++ {
+			x, y = -y, x
+		}
+		return x, y
+	}
+
+	var d strings.Builder
+	for i := 0; i < 4; i++ {
+		cx, cy := rotate(0, -c, i)
+		x0, y0 := rotate(arm-o, -arm-o, i)
+		x1, y1 := rotate(arm+o, -arm+o, i)
+		if i == 0 {
+			fmt.Fprintf(&d, "M%s %s", num(cx), num(cy))
+		} else {
+			fmt.Fprintf(&d, "L%s %s", num(cx), num(cy))
+		}
+		fmt.Fprintf(&d, "L%s %sA%s %s 0 0 1 %s %s",
+			num(x0), num(y0), num(w), num(w), num(x1), num(y1))
+	}
+	d.WriteString("Z")
+	return svgPath{d: d.String()}
+}
+
+// svgWriter collects the elements and definitions of an SVG document.
+type svgWriter struct {
+	defs, body bytes.Buffer
+	n          int // last id used
+}
+
+// id returns a new element id.
+func (w *svgWriter) id() string {
+	w.n++
+	return "i" + strconv.Itoa(w.n)
+}
+
+// def adds a line to the definitions.
+func (w *svgWriter) def(format string, a ...interface{}) {
+	fmt.Fprintf(&w.defs, format, a...)
+	w.defs.WriteByte('\n')
+}
+
+// printf adds a line to the document body.
+func (w *svgWriter) printf(format string, a ...interface{}) {
+	fmt.Fprintf(&w.body, format, a...)
+	w.body.WriteByte('\n')
+}
+
+// document returns the SVG document with a viewBox of dim pixels
+// and a width and height of size.
+func (w *svgWriter) document(dim, margin int, size float64) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"`+
+		` width="%s" height="%s" viewBox="%d %d %d %d">`+"\n", num(size), num(size),
+		-margin, -margin, dim+2*margin, dim+2*margin)
+	if w.defs.Len() != 0 {
+		buf.WriteString("<defs>\n")
+		buf.Write(w.defs.Bytes())
+		buf.WriteString("</defs>\n")
+	}
+	buf.Write(w.body.Bytes())
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+// fillShape draws the outline id filled with fill.
+// If stroke is positive, the outer stroke pixels of the shape
+// are drawn with outline instead, like the inset fill of shapeIcon.
+func (w *svgWriter) fillShape(id string, unit float64, fill, outline color.Color, stroke float64) {
+	if stroke <= 0 {
+		w.printf(`<use xlink:href="#%s" %s/>`, id, paint("fill", fill))
+		return
+	}
+
+	// A stroke with round joins clipped to the shape covers
+	// exactly the area within stroke pixels of its edge.
+	clip := w.id()
+	w.def(`<clipPath id="%s"><use xlink:href="#%s"/></clipPath>`, clip, id)
+	w.printf(`<use xlink:href="#%s" clip-path="url(#%s)" %s %s stroke-width="%s" stroke-linejoin="round"/>`,
+		id, clip, paint("fill", fill), paint("stroke", outline), num(2*stroke/unit))
+}
+
+// effectFilter defines a filter drawing effects behind its source
+// like RenderEffects, and returns its id.
+func (w *svgWriter) effectFilter(dim, margin int, effects []Effect) string {
+	id := w.id()
+	w.def(`<filter id="%s" filterUnits="userSpaceOnUse" x="%d" y="%d" width="%d" height="%d" color-interpolation-filters="sRGB">`,
+		id, -margin, -margin, dim+2*margin, dim+2*margin)
+	for i, e := range effects {
+		w.def(`<feGaussianBlur in="SourceAlpha" stdDeviation="%s"/>`, num(e.Radius/2))
+		w.def(`<feOffset dx="%d" dy="%d" result="b%d"/>`, e.Offset.X, e.Offset.Y, i)
+		w.def(`<feFlood %s/>`, paint("flood", e.Color))
+		w.def(`<feComposite in2="b%d" operator="in" result="e%d"/>`, i, i)
+	}
+	w.def(`<feMerge>`)
+	for i := range effects {
+		w.def(`<feMergeNode in="e%d"/>`, i)
+	}
+	w.def(`<feMergeNode in="SourceGraphic"/>`)
+	w.def(`</feMerge>`)
+	w.def(`</filter>`)
+	return id
+}
+
+// tintFilter defines a filter coloring its source with c like tint,
+// and returns its id.
+func (w *svgWriter) tintFilter(c color.Color, tint Tint) string {
+	id := w.id()
+	w.def(`<filter id="%s" color-interpolation-filters="sRGB">`, id)
+	if tint == TintMultiply {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		ch := func(v uint8) string { return num(float64(v) / 0xff) }
+		w.def(`<feColorMatrix type="matrix" values="%s 0 0 0 0 0 %s 0 0 0 0 0 %s 0 0 0 0 0 %s 0"/>`,
+			ch(n.R), ch(n.G), ch(n.B), ch(n.A))
+	} else {
+		w.def(`<feFlood %s/>`, paint("flood", c))
+		w.def(`<feComposite in2="SourceGraphic" operator="in"/>`)
+	}
+	w.def(`</filter>`)
+	return id
+}
+
+// paint returns the attributes setting the color and opacity
+// of the fill, stroke or flood property to c.
+func paint(prop string, c color.Color) string {
+	attr := prop
+	if prop == "flood" {
+		attr = "flood-color"
+	}
+	if c == nil {
+		return attr + `="none"`
+	}
+
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	s := fmt.Sprintf(`%s="#%02x%02x%02x"`, attr, n.R, n.G, n.B)
+	if n.A != 0xff {
+		s += fmt.Sprintf(` %s-opacity="%s"`, prop, num(float64(n.A)/0xff))
+	}
+	return s
+}
+
+// num formats x for SVG with up to 4 decimals.
+func num(x float64) string {
+	x = math.Round(x*1e4) / 1e4
+	if x == 0 {
+		x = 0 // avoid "-0"
+	}
+	return strconv.FormatFloat(x, 'f', -1, 64)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
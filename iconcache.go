@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+
+	"github.com/tajtiattila/beermap/icon"
+	"github.com/tajtiattila/beermap/keyvalue"
+)
+
+// iconRenderVersion is part of render cache keys.
+// Increment it when changes in rendering make cached icons obsolete.
+const iconRenderVersion = 4
+
+// iconJob holds everything an icon image depends on.
+type iconJob struct {
+	r       *icon.Renderer // renderer for the icon size
+	fontKey string         // identifies the fonts of r
+
+	shape    icon.Drawable
+	shapeKey string // identifies shape
+
+	colors  icon.Colors
+	label   string
+	effects []icon.Effect
+	badges  []icon.Badge
+	opacity float64
+}
+
+func (j iconJob) render() image.Image {
+	im := j.r.RenderEffects(j.shape, j.colors, j.label, j.effects)
+	im = j.r.AddBadges(im, j.badges)
+	return icon.Fade(im, j.opacity)
+}
+
+// svg returns the icon as an SVG document of size CSS pixels.
+func (j iconJob) svg(size float64) ([]byte, error) {
+	return j.r.RenderSVG(icon.SVGIcon{
+		Shape:   j.shape,
+		Colors:  j.colors,
+		Label:   j.label,
+		Effects: j.effects,
+		Badges:  j.badges,
+		Opacity: j.opacity,
+	}, size)
+}
+
+// key returns a hash identifying the icon image,
+// or an empty string if the fonts or the shape are unknown.
+func (j iconJob) key() string {
+	if j.fontKey == "" || j.shapeKey == "" {
+		return ""
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%s\n%d %d\n%q\n", iconRenderVersion, j.fontKey, j.shapeKey, j.r.Dim, j.r.Margin, j.label)
+	fmt.Fprintf(h, "colors %s %s %s %s\n", colorKey(j.colors.Outline), colorKey(j.colors.Fill),
+		colorKey(j.colors.Shadow), colorKey(j.colors.Text))
+	for _, e := range j.effects {
+		fmt.Fprintf(h, "effect %s %v %v\n", colorKey(e.Color), e.Radius, e.Offset)
+	}
+	for _, b := range j.badges {
+		fmt.Fprintf(h, "badge %d %d %s %s %s %q\n", b.Mark, b.Corner,
+			colorKey(b.Color), colorKey(b.Outline), colorKey(b.Text), b.Letter)
+	}
+	fmt.Fprintf(h, "opacity %v\n", j.opacity)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func colorKey(c color.Color) string {
+	if c == nil {
+		return "none"
+	}
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
+
+// iconCache stores icon PNGs as content-addressed blobs shared by all maps,
+// and remembers the blob of icons rendered earlier by their render key.
+// It is safe for concurrent use by multiple goroutines.
+type iconCache struct {
+	db keyvalue.DB
+
+	mu      sync.Mutex
+	batch   keyvalue.Batch
+	sums    map[string]string // blob sums by render key set in batch
+	pending map[string][]byte // blob data by sum set in batch
+
+	found     map[string]string // blob sums by render key found in db
+	foundData map[string][]byte // blob data by sum found in db
+}
+
+func newIconCache(db keyvalue.DB, batch keyvalue.Batch) *iconCache {
+	return &iconCache{
+		db:        db,
+		batch:     batch,
+		sums:      make(map[string]string),
+		pending:   make(map[string][]byte),
+		found:     make(map[string]string),
+		foundData: make(map[string][]byte),
+	}
+}
+
+// icon returns a reference to the blob of the icon rendered by job,
+// rendering and storing it if needed.
+// The icon image is returned as well if needImage is set.
+func (c *iconCache) icon(job iconJob, needImage bool) (ref []byte, im image.Image, err error) {
+	key := job.key()
+	if key != "" {
+		c.mu.Lock()
+		sum, ok := c.sums[key]
+		c.mu.Unlock()
+		if !ok {
+			sum, ok, err = c.lookup(key)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if ok {
+			if needImage {
+				im, err = c.image(sum)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			return blobRef(sum), im, nil
+		}
+	}
+
+	im = job.render()
+	data, err := encodePNG(im)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := blobSum(data)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pending[sum]; !ok {
+		c.batch.Set(blobKey(sum), data)
+		c.pending[sum] = data
+	}
+	if key != "" {
+		c.batch.Set(renderKey(key), []byte(sum))
+		c.sums[key] = sum
+	}
+	return blobRef(sum), im, nil
+}
+
+// lookup returns the sum of the blob rendered earlier with key from db.
+// The blob data is kept in c for restore.
+// Render cache entries of missing blobs are ignored.
+func (c *iconCache) lookup(key string) (sum string, ok bool, err error) {
+	raw, err := c.db.Get(renderKey(key))
+	switch err {
+	case nil:
+	case keyvalue.ErrNotFound:
+		return "", false, nil
+	default:
+		return "", false, err
+	}
+	sum = string(raw)
+
+	c.mu.Lock()
+	_, ok = c.foundData[sum]
+	c.mu.Unlock()
+	if !ok {
+		data, err := c.db.Get(blobKey(sum))
+		switch err {
+		case nil:
+		case keyvalue.ErrNotFound:
+			return "", false, nil
+		default:
+			return "", false, err
+		}
+		c.mu.Lock()
+		c.foundData[sum] = data
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	c.found[key] = sum
+	c.mu.Unlock()
+	return sum, true, nil
+}
+
+// restore adds the blobs found in db earlier to the batch again
+// if they have been swept since, so that the references
+// to them in the batch remain valid.
+// It must be called just before committing the batch,
+// and must not run concurrently with sweepBlobs.
+func (c *iconCache) restore() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, sum := range c.found {
+		if _, ok := c.pending[sum]; ok {
+			continue
+		}
+		_, err := c.db.Get(blobKey(sum))
+		switch err {
+		case nil:
+			continue
+		case keyvalue.ErrNotFound:
+		default:
+			return err
+		}
+		c.batch.Set(blobKey(sum), c.foundData[sum])
+		c.batch.Set(renderKey(key), []byte(sum))
+		c.pending[sum] = c.foundData[sum]
+	}
+	return nil
+}
+
+// image returns the decoded icon image of the blob sum.
+func (c *iconCache) image(sum string) (image.Image, error) {
+	c.mu.Lock()
+	data, ok := c.pending[sum]
+	if !ok {
+		data, ok = c.foundData[sum]
+	}
+	c.mu.Unlock()
+	if !ok {
+		var err error
+		data, err = c.db.Get(blobKey(sum))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// renderKey returns the key of the blob sum of the icon with render key k.
+func renderKey(k string) string {
+	return "render|" + k
+}
+
+// blobKey returns the key of the blob with the given sum.
+func blobKey(sum string) string {
+	return "blob|" + sum
+}
+
+// blobSum returns the sum identifying the blob data.
+func blobSum(data []byte) string {
+	s := sha256.Sum256(data)
+	return hex.EncodeToString(s[:])
+}
+
+// blobRef returns the value of path keys referring to the blob sum.
+// References are the keys of the blobs themselves.
+func blobRef(sum string) []byte {
+	return []byte(blobKey(sum))
+}
+
+// sweepBlobs deletes blobs not referenced by path keys,
+// and the render cache entries of deleted blobs.
+// Blobs of icons not used by any map anymore, such as those of
+// fill colors shaded by visit recency, are collected this way.
+// It scans the whole database, so it runs at startup and periodically.
+// It must not run concurrently with committing saves storing blob references,
+// and blobs of icon caches created earlier must be restored before commit.
+func sweepBlobs(db keyvalue.DB) (deleted int, err error) {
+	refs := make(map[string]bool)
+	err = scanPrefix(db, "path|", func(k string, v []byte) {
+		if bytes.HasPrefix(v, []byte("blob|")) {
+			refs[string(v)] = true
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	batch := db.Batch()
+	err = scanPrefix(db, "blob|", func(k string, v []byte) {
+		if !refs[k] {
+			batch.Delete(k)
+			deleted++
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = scanPrefix(db, "render|", func(k string, v []byte) {
+		if !refs[blobKey(string(v))] {
+			batch.Delete(k)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, batch.Commit()
+}
+
+// scanPrefix calls f with the keys and values in db starting with prefix.
+func scanPrefix(db keyvalue.DB, prefix string, f func(k string, v []byte)) error {
+	it := db.Iterator(prefix, "")
+	defer it.Close()
+	for it.Next() {
+		if !strings.HasPrefix(it.Key(), prefix) {
+			break
+		}
+		f(it.Key(), it.Value())
+	}
+	return it.Err()
+}
+
+// getPath returns the data of the path key k, resolving blob references.
+func getPath(db keyvalue.DB, k string) ([]byte, error) {
+	raw, err := db.Get(k)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(raw, []byte("blob|")) {
+		return db.Get(string(raw))
+	}
+	return raw, nil
+}
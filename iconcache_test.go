@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/tajtiattila/beermap/keyvalue"
+)
+
+func newTestDB(t *testing.T) (db keyvalue.DB, cleanup func()) {
+	dir, err := ioutil.TempDir("", "beermap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = keyvalue.OpenLevelDB(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestIconCache(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"styles": [
+			{"cond": "#hotel", "shape": "square", "color": "navy"},
+			{"shape": "circle", "color": "red"}
+		]
+	}`)
+
+	pubs := []Pub{
+		{Label: "1"},
+		{Label: "1", Title: "same icon"},
+		{Label: "1", Tags: []string{"#hotel"}},
+	}
+
+	save := func() (refs [][]byte, blobs int) {
+		batch := db.Batch()
+		c := newIconCache(db, batch)
+		for _, p := range pubs {
+			ref, im, err := c.icon(st.pubJob(p, 2), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if im == nil {
+				t.Fatal("missing image")
+			}
+			refs = append(refs, ref)
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return refs, len(c.pending)
+	}
+
+	refs, blobs := save()
+	if !bytes.Equal(refs[0], refs[1]) || bytes.Equal(refs[0], refs[2]) {
+		t.Errorf("got refs %q", refs)
+	}
+	if blobs != 2 {
+		t.Errorf("got %d blobs, want 2", blobs)
+	}
+
+	again, blobs := save()
+	for i := range refs {
+		if !bytes.Equal(refs[i], again[i]) {
+			t.Errorf("pub %d: got ref %q after save, want %q", i, again[i], refs[i])
+		}
+	}
+	if blobs != 0 {
+		t.Errorf("got %d blobs rendered again", blobs)
+	}
+
+	if err := db.Set("path|test/icon-1.png", refs[0]); err != nil {
+		t.Fatal(err)
+	}
+	data, err := getPath(db, "path|test/icon-1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("\x89PNG")) {
+		t.Errorf("reference not resolved")
+	}
+}
+
+func TestRenderPubIcons(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"styles": [
+			{"cond": "#hotel", "shape": "square", "color": "navy"},
+			{"cond": "#closed", "shape": "diamond", "color": "gray"},
+			{"shape": "circle", "color": "red"}
+		]
+	}`)
+
+	var pubs []Pub
+	for i := 0; i < 50; i++ {
+		p := Pub{Label: strconv.Itoa(i % 20)}
+		switch i % 3 {
+		case 1:
+			p.Tags = []string{"#hotel"}
+		case 2:
+			p.Tags = []string{"#closed"}
+		}
+		pubs = append(pubs, p)
+	}
+
+	c := newIconCache(db, db.Batch())
+	icons := renderPubIcons(pubs, st, c, true)
+	if len(icons) != len(pubs) {
+		t.Fatalf("got %d icons, want %d", len(icons), len(pubs))
+	}
+
+	seq := newIconCache(db, db.Batch())
+	for i, p := range pubs {
+		ic := icons[i]
+		if ic.err != nil {
+			t.Errorf("pub %d: %v", i, ic.err)
+			continue
+		}
+		for j, scale := range iconScales {
+			ref, _, err := seq.icon(st.pubJob(p, scale), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(ic.refs[j], ref) {
+				t.Errorf("pub %d at %dx: got ref %q, want %q", i, scale, ic.refs[j], ref)
+			}
+			if ic.images[j] == nil {
+				t.Errorf("pub %d at %dx: missing image", i, scale)
+			}
+		}
+	}
+	if len(c.pending) != len(seq.pending) {
+		t.Errorf("got %d blobs, want %d", len(c.pending), len(seq.pending))
+	}
+}
+
+func TestSweepBlobs(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"styles": [{"shape": "circle", "color": "red"}]
+	}`)
+
+	save := func(labels ...string) [][]byte {
+		batch := db.Batch()
+		c := newIconCache(db, batch)
+		var refs [][]byte
+		for _, l := range labels {
+			ref, _, err := c.icon(st.pubJob(Pub{Label: l}, 2), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			batch.Set("path|test/icon-"+l+".png", ref)
+			refs = append(refs, ref)
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return refs
+	}
+
+	refs := save("1", "2")
+	if err := db.Delete("path|test/icon-2.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := sweepBlobs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d blobs deleted, want 1", n)
+	}
+	if _, err := getPath(db, "path|test/icon-1.png"); err != nil {
+		t.Errorf("referenced blob: %v", err)
+	}
+	if _, err := db.Get(string(refs[1])); err != keyvalue.ErrNotFound {
+		t.Errorf("unreferenced blob not deleted: %v", err)
+	}
+	var renders int
+	if err := scanPrefix(db, "render|", func(string, []byte) { renders++ }); err != nil {
+		t.Fatal(err)
+	}
+	if renders != 1 {
+		t.Errorf("got %d render cache entries, want 1", renders)
+	}
+
+	// the swept icon is rendered again
+	again := save("2")
+	if !bytes.Equal(again[0], refs[1]) {
+		t.Errorf("got ref %q, want %q", again[0], refs[1])
+	}
+	if _, err := getPath(db, "path|test/icon-2.png"); err != nil {
+		t.Errorf("rendered again: %v", err)
+	}
+
+	if n, err := sweepBlobs(db); err != nil || n != 0 {
+		t.Errorf("got %d blobs deleted, %v; want none", n, err)
+	}
+}
+
+func TestRestoreSweptBlobs(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"styles": [{"shape": "circle", "color": "red"}]
+	}`)
+	job := st.pubJob(Pub{Label: "1"}, 2)
+
+	// render the icon into the cache without referring to it
+	batch := db.Batch()
+	ref, _, err := newIconCache(db, batch).icon(job, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a save finds the cached icon, but it is swept before the save commits
+	batch = db.Batch()
+	c := newIconCache(db, batch)
+	found, _, err := c.icon(job, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(found, ref) {
+		t.Fatalf("got ref %q, want cached %q", found, ref)
+	}
+	if n, err := sweepBlobs(db); err != nil || n != 1 {
+		t.Fatalf("got %d blobs deleted, %v; want 1", n, err)
+	}
+	batch.Set("path|test/icon-1.png", found)
+	if err := c.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getPath(db, "path|test/icon-1.png"); err != nil {
+		t.Errorf("swept blob not restored: %v", err)
+	}
+	if raw, err := db.Get(renderKey(job.key())); err != nil || blobKey(string(raw)) != string(ref) {
+		t.Errorf("got render cache entry %q, %v; want %q", raw, err, ref)
+	}
+
+	// render cache entries of missing blobs are rendered again
+	if err := db.Delete(string(ref)); err != nil {
+		t.Fatal(err)
+	}
+	batch = db.Batch()
+	again, _, err := newIconCache(db, batch).icon(job, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, ref) {
+		t.Errorf("got ref %q, want %q", again, ref)
+	}
+	if _, err := db.Get(string(ref)); err != nil {
+		t.Errorf("missing blob not rendered again: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/png"
+
+	"github.com/pkg/errors"
+)
+
+// ImageSource returns raw PNG image data by name.
+type ImageSource = ResourceSource
+
+// errImageNotFound is returned by image sources that don't have the image.
+var errImageNotFound = errors.New("image not found")
+
+var imageFiles = resourceKind{"image", []string{".png"}, errImageNotFound}
+
+// maxImageDim is the maximum width and height of uploaded images.
+const maxImageDim = 1024
+
+// validImageFileName reports if name may be used
+// to store or look up an image file.
+func validImageFileName(name string) bool {
+	return imageFiles.validFileName(name)
+}
+
+// imageSources returns an ImageSource trying srcs in order.
+func imageSources(srcs ...ImageSource) ImageSource {
+	return imageFiles.sources(srcs...)
+}
+
+// imageDir returns an ImageSource reading image files from dir.
+func imageDir(dir string) ImageSource {
+	return imageFiles.dir(dir)
+}
+
+// imageMap returns an ImageSource serving image files from m.
+func imageMap(m map[string][]byte) ImageSource {
+	return imageFiles.files(m)
+}
+
+// loadImage reads and decodes the named image using src.
+// It returns the SHA-256 hash of the image data as well.
+func loadImage(name string, src ImageSource) (im image.Image, sum [sha256.Size]byte, err error) {
+	if src == nil {
+		return nil, sum, errors.Errorf("image %q not found", name)
+	}
+	raw, err := src(name)
+	if err != nil {
+		return nil, sum, err
+	}
+	im, err = png.Decode(bytes.NewReader(raw))
+	return im, sha256.Sum256(raw), errors.Wrapf(err, "image %q", name)
+}
+
+// checkImageFile verifies an uploaded image file.
+func checkImageFile(name string, raw []byte) error {
+	if !validImageFileName(name) {
+		return errors.Errorf("invalid image file name %q", name)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return errors.Wrapf(err, "image %q", name)
+	}
+	if cfg.Width == 0 || cfg.Height == 0 || cfg.Width > maxImageDim || cfg.Height > maxImageDim {
+		return errors.Errorf("image %q size %dx%d invalid", name, cfg.Width, cfg.Height)
+	}
+	return nil
+}
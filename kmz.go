@@ -3,6 +3,7 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"strings"
@@ -13,9 +14,13 @@ import (
 
 type KMZ struct {
 	Title      string
+	Styles     []kStyle
 	Placemarks []kPlacemark
+	Overlays   []kOverlay
 
-	seq int
+	// styles holds style ids by icon image hash,
+	// so each unique icon is included once
+	styles map[[sha256.Size]byte]string
 
 	closer io.Closer
 	z      *zip.Writer
@@ -23,8 +28,9 @@ type KMZ struct {
 
 func NewKMZ(w io.Writer, title string) *KMZ {
 	return &KMZ{
-		Title: title,
-		z:     zip.NewWriter(w),
+		Title:  title,
+		styles: make(map[[sha256.Size]byte]string),
+		z:      zip.NewWriter(w),
 	}
 }
 
@@ -39,10 +45,14 @@ func (k *KMZ) Close() error {
 	return k.z.Close()
 }
 
+type kStyle struct {
+	ID       string
+	IconPath string
+}
+
 type kPlacemark struct {
 	Placemark
-	StyleID  string
-	IconPath string
+	StyleID string
 }
 
 type Placemark struct {
@@ -51,10 +61,47 @@ type Placemark struct {
 	Lat, Long float64
 }
 
+// IconPlacemark adds pm with the icon png.
+// Placemarks with identical icons share the image and its style.
 func (k *KMZ) IconPlacemark(png []byte, pm Placemark) error {
-	path := fmt.Sprintf("images/icon-%d.png", k.seq)
-	style := fmt.Sprintf("icon-%d-BEE1157", k.seq)
-	k.seq++
+	sum := sha256.Sum256(png)
+	style, ok := k.styles[sum]
+	if !ok {
+		n := len(k.Styles)
+		path := fmt.Sprintf("images/icon-%d.png", n)
+		style = fmt.Sprintf("icon-%d-BEE1157", n)
+
+		f, err := k.z.Create(path)
+		if err != nil {
+			return errors.Wrap(err, "can't create image file in zip")
+		}
+
+		if _, err := f.Write(png); err != nil {
+			return errors.Wrap(err, "can't write image into zip")
+		}
+
+		k.styles[sum] = style
+		k.Styles = append(k.Styles, kStyle{
+			ID:       style,
+			IconPath: path,
+		})
+	}
+
+	k.Placemarks = append(k.Placemarks, kPlacemark{
+		Placemark: pm,
+		StyleID:   style,
+	})
+	return nil
+}
+
+type kOverlay struct {
+	Name      string
+	ImagePath string
+}
+
+// ScreenOverlay adds png fixed at the bottom left of the screen, such as a legend.
+func (k *KMZ) ScreenOverlay(png []byte, name string) error {
+	path := fmt.Sprintf("images/overlay-%d.png", len(k.Overlays))
 
 	f, err := k.z.Create(path)
 	if err != nil {
@@ -65,10 +112,9 @@ func (k *KMZ) IconPlacemark(png []byte, pm Placemark) error {
 		return errors.Wrap(err, "can't write image into zip")
 	}
 
-	k.Placemarks = append(k.Placemarks, kPlacemark{
-		Placemark: pm,
-		StyleID:   style,
-		IconPath:  path,
+	k.Overlays = append(k.Overlays, kOverlay{
+		Name:      name,
+		ImagePath: path,
 	})
 	return nil
 }
@@ -117,8 +163,8 @@ var kmltmp = template.Must(template.New("kmz").Funcs(template.FuncMap{
 <kml xmlns="http://www.opengis.net/kml/2.2">
   <Document>
     <name>{{.Title}}</name>
-{{range .Placemarks}}{{if .StyleID}}
-    <Style id="{{.StyleID}}-normal">
+{{range .Styles}}
+    <Style id="{{.ID}}-normal">
       <IconStyle>
         <scale>1</scale>
         <Icon>
@@ -129,7 +175,7 @@ var kmltmp = template.Must(template.New("kmz").Funcs(template.FuncMap{
         <scale>0</scale>
       </LabelStyle>
     </Style>
-    <Style id="{{.StyleID}}-highlight">
+    <Style id="{{.ID}}-highlight">
       <IconStyle>
         <scale>1</scale>
         <Icon>
@@ -140,17 +186,17 @@ var kmltmp = template.Must(template.New("kmz").Funcs(template.FuncMap{
         <scale>1</scale>
       </LabelStyle>
     </Style>
-    <StyleMap id="{{.StyleID}}">
+    <StyleMap id="{{.ID}}">
       <Pair>
         <key>normal</key>
-        <styleUrl>#{{.StyleID}}-normal</styleUrl>
+        <styleUrl>#{{.ID}}-normal</styleUrl>
       </Pair>
       <Pair>
         <key>highlight</key>
-        <styleUrl>#{{.StyleID}}-highlight</styleUrl>
+        <styleUrl>#{{.ID}}-highlight</styleUrl>
       </Pair>
     </StyleMap>
-{{end}}{{end}}
+{{end}}
 {{range .Placemarks}}
     <Placemark>
       <name>{{.Title | xmlCharData}}</name>
@@ -166,6 +212,17 @@ var kmltmp = template.Must(template.New("kmz").Funcs(template.FuncMap{
         </coordinates>
       </Point>
     </Placemark>
+{{end}}
+{{- range .Overlays}}
+    <ScreenOverlay>
+      <name>{{.Name | xmlCharData}}</name>
+      <Icon>
+        <href>{{.ImagePath}}</href>
+      </Icon>
+      <overlayXY x="0" y="0" xunits="fraction" yunits="fraction"/>
+      <screenXY x="10" y="30" xunits="pixels" yunits="pixels"/>
+      <size x="0" y="0" xunits="pixels" yunits="pixels"/>
+    </ScreenOverlay>
 {{end}}
   </Document>
 </kml>
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// labelData is the data available to label templates.
+type labelData struct {
+	Label string
+	Title string
+	Addr  string
+	Tags  []string
+
+	// Fields holds the values of "#key:value" tags by key.
+	Fields map[string]string
+
+	Visits int // number of visits in the visit log
+}
+
+func newLabelData(p Pub, label string) labelData {
+	d := labelData{
+		Label:  label,
+		Title:  p.Title,
+		Addr:   p.Addr,
+		Tags:   p.Tags,
+		Fields: make(map[string]string),
+		Visits: len(p.Visits),
+	}
+	for _, t := range p.Tags {
+		if !strings.HasPrefix(t, "#") {
+			continue
+		}
+		if i := strings.IndexRune(t, ':'); i > 1 {
+			d.Fields[t[1:i]] = t[i+1:]
+		}
+	}
+	return d
+}
+
+var labelFuncs = template.FuncMap{
+	"initials": initials,
+	"truncate": truncate,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"roman":    roman,
+}
+
+// parseLabelTemplate parses a label template such as "{{initials .Title}}".
+func parseLabelTemplate(src string) (*template.Template, error) {
+	t, err := template.New("label").Funcs(labelFuncs).Option("missingkey=zero").Parse(src)
+	return t, errors.Wrap(err, "label template")
+}
+
+// execLabel returns the label of p using t.
+func execLabel(t *template.Template, p Pub, label string) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, newLabelData(p, label)); err != nil {
+		return "", errors.Wrapf(err, "label of %q", p.Label)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// initials returns the upper case first letters of the words in s.
+func initials(s string) string {
+	var b strings.Builder
+	for _, w := range strings.Fields(s) {
+		r, _ := utf8.DecodeRuneInString(w)
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// truncate returns the first n characters of s.
+// Its argument order allows {{.Title | truncate 3}}.
+func truncate(n int, s string) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// roman returns v in roman numerals. Values out of the range 1 to 3999
+// are returned unchanged, so are strings that are not numbers.
+func roman(v interface{}) (string, error) {
+	var n int
+	switch x := v.(type) {
+	case int:
+		n = x
+	case string:
+		var err error
+		n, err = strconv.Atoi(x)
+		if err != nil {
+			return x, nil
+		}
+	default:
+		return "", errors.Errorf("roman: invalid argument type %T", v)
+	}
+	if n < 1 || n > 3999 {
+		return fmt.Sprint(n), nil
+	}
+
+	numerals := []struct {
+		value int
+		s     string
+	}{
+		{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"},
+		{100, "C"}, {90, "XC"}, {50, "L"}, {40, "XL"},
+		{10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+	}
+	var b strings.Builder
+	for _, x := range numerals {
+		for n >= x.value {
+			b.WriteString(x.s)
+			n -= x.value
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLabelTemplate(t *testing.T) {
+	p := Pub{
+		Label: "012",
+		Title: "Kandalló Pub & Étterem",
+		Tags:  []string{"#hotel", "#rating:4", "#visited:2019-05-03"},
+
+		Visits: []time.Time{time.Date(2019, 5, 3, 0, 0, 0, 0, time.UTC)},
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"{{.Label}}", "012"},
+		{"{{.Label}}★", "012★"},
+		{"{{initials .Title}}", "KPÉ"},
+		{"{{.Title | truncate 3 | upper}}", "KAN"},
+		{"{{.Title | truncate 50}}", "Kandalló Pub & Étterem"},
+		{"{{roman .Label}}", "XII"},
+		{"{{roman 1994}}", "MCMXCIV"},
+		{"{{roman .Title}}", "Kandalló Pub & Étterem"},
+		{"{{.Fields.rating}}", "4"},
+		{"{{.Fields.missing}}", ""},
+		{"{{if .Visits}}✓{{else}}{{.Label}}{{end}}", "✓"},
+		{"{{lower (initials .Title)}}", "kpé"},
+	}
+
+	for _, x := range tests {
+		tmpl, err := parseLabelTemplate(x.src)
+		if err != nil {
+			t.Fatalf("%s: %v", x.src, err)
+		}
+		got, err := execLabel(tmpl, p, p.Label)
+		if err != nil {
+			t.Fatalf("%s: %v", x.src, err)
+		}
+		if got != x.want {
+			t.Errorf("%s got %q, want %q", x.src, got, x.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"image"
+
+	"github.com/tajtiattila/beermap/icon"
+)
+
+const (
+	legendJSON = "legend.json"
+	legendPNG  = "legend.png"
+)
+
+// legendItem is a named style with its icon.
+type legendItem struct {
+	Name string
+	Icon image.Image
+	Size int // icon size in CSS pixels
+}
+
+// legend returns the named styles and their icons
+// rendered with an empty label for the pixel ratio scale.
+func (st *Styler) legend(scale int) []legendItem {
+	var items []legendItem
+	for _, s := range st.styles {
+		if s.Ignore || s.Name == "" {
+			continue
+		}
+
+		if s.Badge != nil {
+			size := st.iconSize(s)
+			dim := size * scale
+			blank := image.NewRGBA(image.Rect(0, 0, dim, dim))
+			im := st.r.WithDim(dim).AddBadges(blank, []icon.Badge{*s.Badge})
+			items = append(items, legendItem{s.Name, im, size})
+			continue
+		}
+
+		if st.cascade {
+			s = standalone(s)
+		}
+		if s.Shape == nil {
+			// hidden pubs
+			continue
+		}
+		size := st.iconSize(s)
+		im := st.renderStyle(s, s.Color, "", size*scale, nil)
+		items = append(items, legendItem{s.Name, im, st.markerSize(s)})
+	}
+	return items
+}
+
+type jLegend struct {
+	Entries []jLegendEntry `json:"entries"`
+}
+
+type jLegendEntry struct {
+	Name string `json:"name"`
+	Icon string `json:"icon"` // data URL
+	Size int    `json:"size"` // icon size in CSS pixels
+}
+
+// legendData returns legend.json with 2x icons and legend.png at 1x,
+// or nil if the styles have no names.
+func legendData(st *Styler) (jsonData, pngData []byte, err error) {
+	items := st.legend(2)
+	if len(items) == 0 {
+		return nil, nil, nil
+	}
+
+	var jl jLegend
+	for _, it := range items {
+		raw, err := encodePNG(it.Icon)
+		if err != nil {
+			return nil, nil, err
+		}
+		jl.Entries = append(jl.Entries, jLegendEntry{
+			Name: it.Name,
+			Icon: "data:image/png;base64," + base64.StdEncoding.EncodeToString(raw),
+			Size: it.Size,
+		})
+	}
+	jsonData, err = json.Marshal(jl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []icon.LegendEntry
+	for _, it := range st.legend(1) {
+		entries = append(entries, icon.LegendEntry{Icon: it.Icon, Text: it.Name})
+	}
+	pngData, err = encodePNG(st.r.WithDim(defaultIconSize).Legend(entries))
+	if err != nil {
+		return nil, nil, err
+	}
+	return jsonData, pngData, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLegend(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`{
+			"font": "Roboto-Medium.ttf",
+			"styles": [
+				{"name": "closed", "cond": "#closed", "badge": {"mark": "cross", "color": "red"}},
+				{"name": "hidden", "cond": "#hidden", "shape": "none"},
+				{"name": "old", "cond": "#old", "ignore": true, "shape": "circle", "color": "gray"},
+				{"cond": "#x", "shape": "star", "color": "red"},
+				{"name": "hotel", "cond": "#hotel", "shape": "square", "color": "olive", "size": 40},
+				{"name": "other", "shape": "circle", "color": "blue"}
+			]
+		}`, "closed hotel other"},
+		{`{
+			"font": "Roboto-Medium.ttf",
+			"mode": "cascade",
+			"styles": [
+				{"shape": "circle", "color": "blue"},
+				{"name": "visited", "cond": "#visited", "color": "green"},
+				{"name": "gone", "cond": "#gone", "shape": "none"}
+			]
+		}`, "visited"},
+		{`{
+			"font": "Roboto-Medium.ttf",
+			"styles": [{"shape": "circle", "color": "blue"}]
+		}`, ""},
+	}
+
+	for i, x := range tests {
+		st := newTestStyler(t, x.src)
+		lj, lp, err := legendData(st)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if x.want == "" {
+			if lj != nil || lp != nil {
+				t.Errorf("#%d: want no legend", i)
+			}
+			continue
+		}
+
+		var jl jLegend
+		if err := json.Unmarshal(lj, &jl); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		var names []string
+		for _, e := range jl.Entries {
+			names = append(names, e.Name)
+			if !strings.HasPrefix(e.Icon, "data:image/png;base64,") {
+				t.Errorf("#%d: %s has invalid icon", i, e.Name)
+			}
+		}
+		if got := strings.Join(names, " "); got != x.want {
+			t.Errorf("#%d: got %q, want %q", i, got, x.want)
+		}
+		if len(lp) == 0 {
+			t.Errorf("#%d: missing legend image", i)
+		}
+	}
+}
@@ -22,6 +22,7 @@ func main() {
 	addr := flag.String("addr", ":8080", "default listen address")
 	res := flag.String("res", "./res", "resource path")
 	dbpath := flag.String("db", "./db", "database path")
+	fontdir := flag.String("fontdir", "", "server font directory (default: resource path)")
 	prefix := flag.String("prefix", "", "optional server prefix")
 	flag.Parse()
 
@@ -54,6 +55,12 @@ func main() {
 
 	mdb := &mapDB{db: db}
 
+	if n, err := sweepBlobs(db); err != nil {
+		log.Println("sweep icon blobs:", err)
+	} else if n != 0 {
+		log.Printf("deleted %d unused icon blobs", n)
+	}
+
 	fontcache := &FontCache{
 		db:     db,
 		prefix: "fontdata/",
@@ -68,7 +75,11 @@ func main() {
 
 	editor := newEditor("/edit/", filepath.Join(*res, "ui/edit"), mdb, gc)
 	editor.defaultIconRenderer = ir
-	editor.fontSrc = fontcache.Get
+	go editor.sweepBlobsEvery(24 * time.Hour)
+	if *fontdir == "" {
+		*fontdir = *res
+	}
+	editor.fontSrc = serverFonts(*fontdir, fontcache.Get)
 	httpHandle("/edit/", editor)
 
 	httpHandle("/map/", http.StripPrefix("/map",
@@ -3,18 +3,37 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"html/template"
-	"image/png"
+	"image"
 	"log"
 	"net/http"
 	"path"
 	"regexp"
 	"time"
+
+	"github.com/tajtiattila/beermap/icon"
 )
 
 type mapData struct {
 	Bounds jbounds `json:"bounds"`
 	Pubs   []jpub  `json:"pubs"`
+
+	// TimeZone is the IANA time zone name
+	// opening hours should be evaluated in.
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Sprites holds the sprite sheets of icons, if enabled.
+	Sprites *jsprites `json:"sprites,omitempty"`
+}
+
+type jsprites struct {
+	// Width and Height are the sheet size in CSS pixels.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// Images holds sheet URLs by pixel ratio, eg. "2x".
+	Images map[string]string `json:"images"`
 }
 
 type jbounds struct {
@@ -31,10 +50,39 @@ type jpub struct {
 	Long    float64 `json:"lng"`
 	Icon    string  `json:"icon"`
 	Content string  `json:"content"`
+
+	Hours *OpeningHours `json:"hours,omitempty"`
+
+	// Size is the marker size in CSS pixels.
+	Size int `json:"size"`
+
+	// Icons holds icon URLs by pixel ratio, eg. "2x",
+	// and "svg" for the vector icon if enabled.
+	Icons map[string]string `json:"icons"`
+
+	// Anchor is the icon anchor as a fraction of the icon size,
+	// missing means the bottom center.
+	Anchor *[2]float64 `json:"anchor,omitempty"`
+
+	// Sprite is the icon position within the sprite sheets in CSS pixels.
+	Sprite *[2]int `json:"sprite,omitempty"`
 }
 
-func pubListJSON(pubs []Pub, iconpfx string) []byte {
-	var md mapData
+// pubListJSON returns the map data of pubs.
+// If sprites is not nil, it must hold the encoded sprite sheet of pubs.
+// Vector icons are listed for pubs having svg set at their index.
+func pubListJSON(pubs []Pub, iconpfx string, styler *Styler, sprites *spriteSheet, svg []bool) []byte {
+	md := mapData{TimeZone: styler.timeZone}
+	if sprites != nil {
+		md.Sprites = &jsprites{
+			Width:  sprites.w,
+			Height: sprites.h,
+			Images: make(map[string]string),
+		}
+		for _, scale := range iconScales {
+			md.Sprites.Images[fmt.Sprintf("%dx", scale)] = path.Join(iconpfx, sprites.variantName(scale))
+		}
+	}
 	for i, p := range pubs {
 		if i == 0 {
 			md.Bounds.N = p.Geo.Lat
@@ -76,6 +124,22 @@ func pubListJSON(pubs []Pub, iconpfx string) []byte {
 			Long:    p.Geo.Long,
 			Icon:    xp.Icon,
 			Content: buf.String(),
+			Hours:   p.Hours,
+			Size:    styler.PubIconSize(p),
+			Icons:   make(map[string]string),
+		}
+		for _, scale := range iconScales {
+			jp.Icons[fmt.Sprintf("%dx", scale)] = path.Join(iconpfx, p.IconVariantBasename(scale))
+		}
+		if i < len(svg) && svg[i] {
+			jp.Icons["svg"] = path.Join(iconpfx, p.IconSVGBasename())
+		}
+		if x, y, ok := styler.PubAnchor(p); ok {
+			jp.Anchor = &[2]float64{x, y}
+		}
+		if sprites != nil {
+			sp := sprites.pos[i]
+			jp.Sprite = &[2]int{sp.X, sp.Y}
 		}
 		md.Pubs = append(md.Pubs, jp)
 	}
@@ -86,8 +150,8 @@ func pubListJSON(pubs []Pub, iconpfx string) []byte {
 	return raw
 }
 
-func servePubData(pubs []Pub, iconpfx string) http.Handler {
-	raw := pubListJSON(pubs, iconpfx)
+func servePubData(pubs []Pub, iconpfx string, styler *Styler) http.Handler {
+	raw := pubListJSON(pubs, iconpfx, styler, nil, nil)
 	now := time.Now()
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		http.ServeContent(w, req, "pubs.json", now, bytes.NewReader(raw))
@@ -101,6 +165,9 @@ var contentTmpl = template.Must(template.New("info").Funcs(template.FuncMap{
 <span class="pubinfo-titletext">{{.Title}}</span>
 </h1>
 <p class="pubinfo-addr">{{.Addr}}</p>
+{{- with .Hours}}
+<p class="pubinfo-hours">{{.Src}}</p>
+{{- end}}
 <p class="pubinfo-desc">{{range .Desc}}
 {{. | addLinks}}<br>
 {{end}}</p>
@@ -113,11 +180,10 @@ func addLinks(s string) template.HTML {
 	return template.HTML(linkRe.ReplaceAllString(s, `<a target="pub" href="$0">$0</a>`))
 }
 
-// pubIconData generates PNG image data for pub using styler
-func pubIconData(pub Pub, styler *Styler) ([]byte, error) {
+// encodePNG returns the PNG image data of im optimized for size.
+func encodePNG(im image.Image) ([]byte, error) {
 	buf := new(bytes.Buffer)
-	err := png.Encode(buf, styler.PubIcon(pub))
-	if err != nil {
+	if err := icon.EncodePNG(buf, im); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
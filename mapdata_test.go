@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// decodePubList returns the pubs in map data from pubListJSON.
+func decodePubList(t *testing.T, raw []byte) []jpub {
+	t.Helper()
+	var md mapData
+	if err := json.Unmarshal(raw, &md); err != nil {
+		t.Fatal(err)
+	}
+	return md.Pubs
+}
+
+func TestPubListAnchor(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"styles": [
+			{"cond": "#pin", "shape": "pin", "color": "navy"},
+			{"shape": "circle", "color": "navy"}
+		]
+	}`)
+
+	pubs := []Pub{
+		{Label: "1"},
+		{Label: "2", Tags: []string{"#pin"}},
+	}
+	got := decodePubList(t, pubListJSON(pubs, "", st, nil, nil))
+	if len(got) != len(pubs) {
+		t.Fatalf("got %d pubs, want %d", len(got), len(pubs))
+	}
+	if got[0].Anchor != nil {
+		t.Errorf("circle: got anchor %v, want none", *got[0].Anchor)
+	}
+	want := [2]float64{0.5, float64(st.r.Dim-st.r.Padding) / float64(st.r.Dim)}
+	if got[1].Anchor == nil || *got[1].Anchor != want {
+		t.Errorf("pin: got anchor %v, want %v", got[1].Anchor, want)
+	}
+}
+
+func TestIconVariantBasename(t *testing.T) {
+	tests := []struct {
+		label string
+		scale int
+		want  string
+	}{
+		{"12", 1, "icon-12@1x.png"},
+		{"12", 2, "icon-12.png"},
+		{"12", 3, "icon-12@3x.png"},
+		{"A1", 3, "icon-A1@3x.png"},
+	}
+	for _, x := range tests {
+		if got := (Pub{Label: x.label}).IconVariantBasename(x.scale); got != x.want {
+			t.Errorf("%s at %dx: got %q, want %q", x.label, x.scale, got, x.want)
+		}
+	}
+}
+
+func TestPubListSizes(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"size": 32,
+		"svg": true,
+		"styles": [
+			{"cond": "#big", "shape": "circle", "color": "red", "size": 40},
+			{"shape": "circle", "color": "navy"}
+		]
+	}`)
+
+	pubs := []Pub{
+		{Label: "1"},
+		{Label: "2", Tags: []string{"#big"}},
+	}
+	// the vector icon of the second pub is missing
+	got := decodePubList(t, pubListJSON(pubs, "icons", st, nil, []bool{true, false}))
+	if len(got) != len(pubs) {
+		t.Fatalf("got %d pubs, want %d", len(got), len(pubs))
+	}
+	for i, want := range []int{32, 40} {
+		jp := got[i]
+		if jp.Size != want {
+			t.Errorf("%s: got size %d, want %d", jp.Label, jp.Size, want)
+		}
+		icons := map[string]string{
+			"1x": "icons/icon-" + jp.Label + "@1x.png",
+			"2x": "icons/icon-" + jp.Label + ".png",
+			"3x": "icons/icon-" + jp.Label + "@3x.png",
+		}
+		if i == 0 {
+			icons["svg"] = "icons/icon-" + jp.Label + ".svg"
+		}
+		if len(jp.Icons) != len(icons) {
+			t.Errorf("%s: got icons %v, want %v", jp.Label, jp.Icons, icons)
+		}
+		for k, v := range icons {
+			if jp.Icons[k] != v {
+				t.Errorf("%s: got icon %s %q, want %q", jp.Label, k, jp.Icons[k], v)
+			}
+		}
+		if jp.Icon != icons["2x"] {
+			t.Errorf("%s: got icon %q, want %q", jp.Label, jp.Icon, icons["2x"])
+		}
+	}
+}
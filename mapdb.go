@@ -44,6 +44,28 @@ func (m mapDB) Access(key string) error {
 	return m.db.Set("access|"+key, []byte(ts))
 }
 
+// FontSource returns a FontSource for font files uploaded with map key.
+func (m mapDB) FontSource(key string) FontSource {
+	return fontFiles.db(m.db, func(name string) string {
+		return mapFontKey(key, name)
+	})
+}
+
+func mapFontKey(key, name string) string {
+	return "font|" + key + "/" + name
+}
+
+// ImageSource returns an ImageSource for image files uploaded with map key.
+func (m mapDB) ImageSource(key string) ImageSource {
+	return imageFiles.db(m.db, func(name string) string {
+		return mapImageKey(key, name)
+	})
+}
+
+func mapImageKey(key, name string) string {
+	return "image|" + key + "/" + name
+}
+
 // mapMeta holds map metadata
 type mapMeta struct {
 	Key      string `json:"-"`
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tajtiattila/beermap/icon"
+)
+
+// defaultPreviewSamples are used if no samples are specified for the preview.
+var defaultPreviewSamples = []Pub{{Label: "1"}, {Label: "12"}, {Label: "123"}}
+
+// maxPreviewSamples is the maximum number of samples in a preview.
+const maxPreviewSamples = 20
+
+// servePreview renders a preview sheet of an icon style with sample pubs,
+// or responds with the errors in the style.
+//
+// The style is taken from the "style" form value, the "iconstyle" file
+// or the style stored with the map, in this order.
+// Samples are specified in the "samples" form value, one per line,
+// with the label followed by tags, eg. "12 #hotel #visited:2019-05-03".
+func (e *editor) servePreview(w http.ResponseWriter, req *http.Request, mm mapMeta) {
+	if req.Method != "POST" {
+		httpErrorCode(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	form, err := parseMultipartForm(req, 1<<20, func(formName string) (maxLen, maxMultiLen int64) {
+		if formName == "iconstyle" {
+			return 1 << 20, 0
+		}
+		return 0, 0
+	})
+	if err != nil {
+		servePreviewErrors(w, err)
+		return
+	}
+
+	styleBytes := []byte(form.Values.Get("style"))
+	if len(bytes.TrimSpace(styleBytes)) == 0 {
+		if f, ok := form.File("iconstyle"); ok {
+			styleBytes = f.Content
+		} else if styleBytes, err = e.mdb.db.Get("iconstyle|" + mm.Key); err != nil {
+			servePreviewErrors(w, errors.Wrap(err, "icon style missing"))
+			return
+		}
+	}
+
+	samples, err := parsePreviewSamples(form.Values.Get("samples"))
+	if err != nil {
+		servePreviewErrors(w, err)
+		return
+	}
+
+	fontSrc := fontSources(e.mdb.FontSource(mm.Key), e.fontSrc)
+	imageSrc := imageSources(e.mdb.ImageSource(mm.Key))
+	styler, err := NewStyler(bytes.NewReader(styleBytes), fontSrc, imageSrc)
+	if err != nil {
+		servePreviewErrors(w, err)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, styler.previewSheet(samples)); err != nil {
+		log.Println(err)
+		httpErrorCode(w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(buf.Bytes())
+}
+
+// servePreviewErrors responds with errors as JSON.
+func servePreviewErrors(w http.ResponseWriter, errs ...error) {
+	var j struct {
+		Errors []string `json:"errors"`
+	}
+	for _, err := range errs {
+		j.Errors = append(j.Errors, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(j); err != nil {
+		log.Println(err)
+	}
+}
+
+// parsePreviewSamples parses sample pubs, one per line
+// with the label followed by tags.
+func parsePreviewSamples(src string) ([]Pub, error) {
+	var pubs []Pub
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		f := strings.Fields(scanner.Text())
+		if len(f) == 0 {
+			continue
+		}
+		if len(pubs) == maxPreviewSamples {
+			return nil, errors.Errorf("too many samples, maximum is %d", maxPreviewSamples)
+		}
+		p := Pub{Label: f[0], Title: f[0], Tags: f[1:]}
+		var err error
+		p.Visits, err = parseVisits(p.Tags)
+		if err != nil {
+			return nil, errors.Wrapf(err, "sample line %d", lineno)
+		}
+		pubs = append(pubs, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(pubs) == 0 {
+		return defaultPreviewSamples, nil
+	}
+	return pubs, nil
+}
+
+// previewSheet renders each style with the labels of samples ignoring conditions,
+// followed by the icons of samples using the styles matching them.
+func (st *Styler) previewSheet(samples []Pub) image.Image {
+	return st.r.WithDim(defaultIconSize).Legend(st.previewEntries(samples))
+}
+
+// previewEntries returns the rows of the preview sheet,
+// one for each style and a last one for the samples.
+func (st *Styler) previewEntries(samples []Pub) []icon.LegendEntry {
+	var entries []icon.LegendEntry
+	for i, s := range st.styles {
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		if st.cascade && s.Badge == nil {
+			s = standalone(s)
+		}
+
+		var row []image.Image
+		switch {
+		case s.Ignore:
+			name += " (ignored)"
+		case s.Badge != nil:
+			for _, p := range samples {
+				b := st.baseStyle(p)
+				row = append(row, st.renderStyle(b, b.Color, st.pubLabel(p, b),
+					2*st.iconSize(b), []icon.Badge{*s.Badge}))
+			}
+		case s.Shape == nil:
+			name += " (hidden)"
+		default:
+			for _, p := range samples {
+				row = append(row, st.renderStyle(s, s.Color, st.pubLabel(p, s), 2*st.iconSize(s), nil))
+			}
+		}
+		entries = append(entries, icon.LegendEntry{Icon: hconcat(row), Text: name})
+	}
+
+	var row []image.Image
+	for _, p := range samples {
+		if st.Visible(p) {
+			row = append(row, st.PubIcon(p))
+		}
+	}
+	entries = append(entries, icon.LegendEntry{Icon: hconcat(row), Text: "samples"})
+	return entries
+}
+
+// baseStyle returns the style p would get without badges,
+// or a plain circle if it has none.
+func (st *Styler) baseStyle(p Pub) Style {
+	if s, ok := st.pubStyle(p); ok && s.Shape != nil {
+		return s
+	}
+	s := cascadeBase()
+	s.Shape = icon.Circle
+	return s
+}
+
+// hconcat returns ims placed next to each other, aligned at their centers.
+func hconcat(ims []image.Image) image.Image {
+	const gap = 4
+	var w, h int
+	for i, im := range ims {
+		b := im.Bounds()
+		if i != 0 {
+			w += gap
+		}
+		w += b.Dx()
+		if b.Dy() > h {
+			h = b.Dy()
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	x := 0
+	for _, im := range ims {
+		b := im.Bounds()
+		p := image.Pt(x, (h-b.Dy())/2)
+		draw.Draw(dst, b.Sub(b.Min).Add(p), im, b.Min, draw.Over)
+		x += b.Dx() + gap
+	}
+	return dst
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParsePreviewSamples(t *testing.T) {
+	pubs, err := parsePreviewSamples("12 #hotel #visited:2019-05-03\n\n  7\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pubs) != 2 || pubs[0].Label != "12" || pubs[1].Label != "7" {
+		t.Fatalf("got %v", pubs)
+	}
+	if !pubs[0].Has("#hotel") || len(pubs[0].Visits) != 1 {
+		t.Errorf("sample tags not parsed: %v", pubs[0])
+	}
+
+	pubs, err = parsePreviewSamples("")
+	if err != nil || len(pubs) != len(defaultPreviewSamples) {
+		t.Errorf("default samples got %v, %v", pubs, err)
+	}
+
+	if _, err := parsePreviewSamples("1 #visited:yesterday"); err == nil {
+		t.Error("invalid visit accepted")
+	}
+	if _, err := parsePreviewSamples(strings.Repeat("1\n", maxPreviewSamples+1)); err == nil {
+		t.Error("too many samples accepted")
+	}
+}
+
+func TestPreviewSheet(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"styles": [
+			{"cond": "#closed", "badge": {"mark": "cross", "color": "red"}},
+			{"name": "gone", "cond": "#gone", "shape": "none"},
+			{"name": "old", "cond": "#old", "ignore": true, "shape": "circle", "color": "gray"},
+			{"name": "hotel", "cond": "#hotel", "shape": "square", "color": "olive"},
+			{"name": "other", "shape": "circle", "color": "blue"}
+		]
+	}`)
+	samples, err := parsePreviewSamples("1 #closed\n12 #hotel\n123 #gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		dim = 2 * defaultIconSize
+		gap = 4 // between icons of hconcat
+	)
+	tests := []struct {
+		text  string
+		fills []string // fill colors of icons in the row
+		badge bool     // red badges in the row
+	}{
+		{"#1", []string{"blue", "olive", "black"}, true},
+		{"gone (hidden)", nil, false},
+		{"old (ignored)", nil, false},
+		{"hotel", []string{"olive", "olive", "olive"}, false},
+		{"other", []string{"blue", "blue", "blue"}, false},
+		{"samples", []string{"blue", "olive"}, true},
+	}
+
+	entries := st.previewEntries(samples)
+	if len(entries) != len(tests) {
+		t.Fatalf("got %d rows, want %d", len(entries), len(tests))
+	}
+	for i, x := range tests {
+		e := entries[i]
+		if e.Text != x.text {
+			t.Errorf("row %d: got text %q, want %q", i, e.Text, x.text)
+		}
+		b := e.Icon.Bounds()
+		if want := len(x.fills)*(dim+gap) - gap; len(x.fills) != 0 && b.Dx() != want {
+			t.Errorf("%s: got width %d, want %d", x.text, b.Dx(), want)
+			continue
+		}
+		for k, fill := range x.fills {
+			// above the label in the middle of the icon
+			pt := image.Pt(b.Min.X+k*(dim+gap)+dim/2, b.Min.Y+dim/2-dim/3)
+			want, _ := decodeColor(fill)
+			if got := e.Icon.At(pt.X, pt.Y); !sameColor(got, want) {
+				t.Errorf("%s: icon %d got %v at %v, want %s", x.text, k, got, pt, fill)
+			}
+		}
+		if got := hasColor(e.Icon, color.RGBA{0xff, 0, 0, 0xff}); got != x.badge {
+			t.Errorf("%s: got red badge %v, want %v", x.text, got, x.badge)
+		}
+	}
+
+	b := st.previewSheet(samples).Bounds()
+	if b.Dy() < 4*dim || b.Dx() < 3*dim {
+		t.Errorf("preview sheet too small: %v", b)
+	}
+}
+
+// hasColor reports if im has a pixel of color c.
+func hasColor(im image.Image, c color.Color) bool {
+	b := im.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if sameColor(im.At(x, y), c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestServePreview(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	e := &editor{mdb: &mapDB{db}, fontSrc: fontDir("res")}
+
+	tests := []struct {
+		style  string
+		status int
+		errs   []string
+	}{
+		{`{"font": "Roboto-Medium.ttf", "styles": [{"shape": "circle", "color": "blue"}]}`,
+			http.StatusOK, nil},
+		{`{"font": "Roboto-Medium.ttf", "styles": [{"cond": "#a and", "shape": "circle", "color": "blue"}]}`,
+			http.StatusBadRequest, []string{"style #1", "invalid expression"}},
+		{`{"font": "Roboto-Medium.ttf", "styles": [{"cond": "#a", "shape": "circle"}]}`,
+			http.StatusBadRequest, []string{"style #1", "missing color"}},
+		{`{"font": "Missing.ttf", "styles": [{"shape": "circle", "color": "blue"}]}`,
+			http.StatusBadRequest, []string{`font "Missing.ttf" not found`}},
+		{`{"styles": [`, http.StatusBadRequest, []string{"unexpected EOF"}},
+	}
+
+	for _, x := range tests {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		mw.WriteField("style", x.style)
+		mw.WriteField("samples", "1 #a")
+		mw.Close()
+		req := httptest.NewRequest("POST", "/preview", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+
+		e.servePreview(w, req, mapMeta{Key: "test"})
+
+		if w.Code != x.status {
+			t.Errorf("%s: got status %d, want %d", x.style, w.Code, x.status)
+			continue
+		}
+		if x.status == http.StatusOK {
+			if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+				t.Errorf("%s: got content type %q", x.style, ct)
+			}
+			continue
+		}
+		var j struct {
+			Errors []string `json:"errors"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &j); err != nil || len(j.Errors) != 1 {
+			t.Errorf("%s: got response %q", x.style, w.Body.Bytes())
+			continue
+		}
+		for _, want := range x.errs {
+			if !strings.Contains(j.Errors[0], want) {
+				t.Errorf("%s: got error %q, want %q", x.style, j.Errors[0], want)
+			}
+		}
+	}
+}
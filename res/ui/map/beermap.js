@@ -36,22 +36,61 @@ function startMap(styles, mapData) {
   listControlDiv.index = 1;
   map.controls[google.maps.ControlPosition.TOP_LEFT].push(listControlDiv);
 
+  var markers = [];
+  var openControlDiv = document.createElement('div');
+  openControlDiv.style.padding = "10px";
+  var openControl = new OpenNowControl(openControlDiv, mapData.timeZone, markers);
+
+  openControlDiv.index = 2;
+  map.controls[google.maps.ControlPosition.TOP_LEFT].push(openControlDiv);
+
+  fetch("legend.json")
+    .then(function(response) {
+      if (!response.ok) {
+        throw new Error("no legend");
+      }
+      return response.json();
+    })
+    .then(function(legend) {
+      var legendDiv = document.createElement('div');
+      legendDiv.style.padding = "10px";
+      new LegendControl(legendDiv, legend);
+      map.controls[google.maps.ControlPosition.LEFT_BOTTOM].push(legendDiv);
+    })
+    .catch(function() {
+      // map without legend
+    });
+
   var infowindow = new google.maps.InfoWindow();
 
   var publist = document.getElementById("sidebar-content");
   mapData.pubs.forEach(function(p) {
+    var size = p.size || 28;
+    var icon = {
+      url: iconURL(p),
+      scaledSize: new google.maps.Size(size, size)
+    };
+    if (mapData.sprites && p.sprite) {
+      icon = {
+        url: ratioURL(mapData.sprites.images),
+        size: new google.maps.Size(size, size),
+        origin: new google.maps.Point(p.sprite[0], p.sprite[1]),
+        scaledSize: new google.maps.Size(mapData.sprites.width, mapData.sprites.height)
+      };
+    }
+    if (p.anchor) {
+      icon.anchor = new google.maps.Point(size * p.anchor[0], size * p.anchor[1]);
+    }
     var marker = new google.maps.Marker({
         position: new google.maps.LatLng(p.lat, p.lng),
-        icon: {
-          url: p.icon,
-          scaledSize: new google.maps.Size(28, 28)
-        },
+        icon: icon,
         map: map,
     });
     marker.addListener('click', function() {
       infowindow.setContent(p.content);
       infowindow.open(map, marker);
     });
+    markers.push({marker: marker, hours: p.hours});
 
     var div = document.createElement("div");
     div.className = "publist-item";
@@ -59,7 +98,16 @@ function startMap(styles, mapData) {
     iconDiv.className = "publist-icon";
     var img = document.createElement("img");
     img.className = "publist-iconimg";
-    img.src = p.icon;
+    if (mapData.sprites && p.sprite) {
+      // show the icon as the background of a transparent image
+      var f = 28 / size;
+      img.src = "data:image/gif;base64,R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7";
+      img.style.backgroundImage = "url(" + ratioURL(mapData.sprites.images) + ")";
+      img.style.backgroundPosition = (-p.sprite[0] * f) + "px " + (-p.sprite[1] * f) + "px";
+      img.style.backgroundSize = (mapData.sprites.width * f) + "px " + (mapData.sprites.height * f) + "px";
+    } else {
+      img.src = iconURL(p);
+    }
     $(img).click(function() {
       infowindow.setContent(p.content);
       infowindow.open(map, marker);
@@ -72,6 +120,35 @@ function startMap(styles, mapData) {
     div.appendChild(labelDiv);
     publist.appendChild(div);
   });
+
+  if (window.location.hash == "#open") {
+    openControl.toggle();
+  }
+}
+
+// iconURL returns the vector icon of p if available,
+// or the one best matching the device pixel ratio.
+function iconURL(p) {
+  if (!p.icons) {
+    return p.icon;
+  }
+  if (p.icons.svg) {
+    return p.icons.svg;
+  }
+  return ratioURL(p.icons) || p.icon;
+}
+
+// ratioURL returns the URL from urls by pixel ratio
+// best matching the device pixel ratio.
+function ratioURL(urls) {
+  var ratio = window.devicePixelRatio || 1;
+  if (ratio > 2 && urls["3x"]) {
+    return urls["3x"];
+  }
+  if (ratio > 1 && urls["2x"]) {
+    return urls["2x"];
+  }
+  return urls["1x"];
 }
 
 function ListControl(controlDiv, map) {
@@ -100,3 +177,115 @@ function ListControl(controlDiv, map) {
   });
 
 }
+
+// LegendControl shows the named icon styles.
+// Clicking it toggles between the full legend and just its title.
+function LegendControl(controlDiv, legend) {
+  var controlUI = document.createElement('div');
+  controlUI.className = "mapcontrol-ui legend";
+  controlUI.title = "Toggle legend";
+  controlDiv.appendChild(controlUI);
+
+  var entries = document.createElement('div');
+  legend.entries.forEach(function(e) {
+    var row = document.createElement('div');
+    row.className = "legend-item";
+    var img = document.createElement('img');
+    img.src = e.icon;
+    img.width = e.size;
+    img.height = e.size;
+    row.appendChild(img);
+    var name = document.createElement('span');
+    name.className = "legend-name";
+    name.textContent = e.name;
+    row.appendChild(name);
+    entries.appendChild(row);
+  });
+  controlUI.appendChild(entries);
+
+  var title = document.createElement('div');
+  title.className = "mapcontrol-text hidden";
+  title.innerHTML = "Legend";
+  controlUI.appendChild(title);
+
+  controlUI.addEventListener('click', function() {
+    $(entries).toggleClass("hidden");
+    $(title).toggleClass("hidden");
+  });
+}
+
+// OpenNowControl toggles a view where pubs closed at the moment are greyed out.
+function OpenNowControl(controlDiv, timeZone, markers) {
+  var control = this;
+  var active = false;
+  var timer = null;
+
+  var controlUI = document.createElement('div');
+  controlUI.className = "mapcontrol-ui";
+  controlUI.title = "Show pubs open now";
+  controlDiv.appendChild(controlUI);
+
+  var controlText = document.createElement('div');
+  controlText.className = "mapcontrol-text";
+  controlText.innerHTML = "Open now";
+  controlUI.appendChild(controlText);
+
+  function update() {
+    var now = zoneTime(new Date(), timeZone);
+    markers.forEach(function(m) {
+      var open = !active || (m.hours && isOpenAt(m.hours, now.day, now.minute));
+      m.marker.setOpacity(open ? 1 : 0.3);
+    });
+  }
+
+  this.toggle = function() {
+    active = !active;
+    $(controlUI).toggleClass("mapcontrol-active", active);
+    if (timer !== null) {
+      clearInterval(timer);
+      timer = null;
+    }
+    if (active) {
+      timer = setInterval(update, 60 * 1000);
+    }
+    update();
+  };
+
+  controlUI.addEventListener('click', function() {
+    control.toggle();
+  });
+}
+
+// zoneTime returns the weekday (0 is Sunday) and minutes from midnight
+// of date in timeZone, or in local time if timeZone is empty.
+function zoneTime(date, timeZone) {
+  if (!timeZone) {
+    return {day: date.getDay(), minute: date.getHours() * 60 + date.getMinutes()};
+  }
+  var parts = {};
+  new Intl.DateTimeFormat("en-US", {
+    timeZone: timeZone,
+    weekday: "short",
+    hour: "numeric",
+    minute: "numeric",
+    hourCycle: "h23"
+  }).formatToParts(date).forEach(function(p) {
+    parts[p.type] = p.value;
+  });
+  var days = ["Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"];
+  return {
+    day: days.indexOf(parts.weekday),
+    minute: parseInt(parts.hour, 10) * 60 + parseInt(parts.minute, 10)
+  };
+}
+
+// isOpenAt mirrors OpeningHours.openAt in hours.go.
+function isOpenAt(hours, day, minute) {
+  var open = function(spans, m) {
+    return spans.some(function(s) {
+      return s.open <= m && m < s.close;
+    });
+  };
+  var prev = (day + 6) % 7;
+  return open(hours.week[day], minute) || open(hours.week[prev], minute + 24 * 60);
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tajtiattila/beermap/keyvalue"
+)
+
+// ResourceSource returns raw resource file data, such as a font, by name.
+type ResourceSource func(name string) ([]byte, error)
+
+// resourceKind is a kind of resource files looked up by name
+// from files uploaded with the map, server directories or elsewhere.
+type resourceKind struct {
+	name     string   // used in messages, eg. "font"
+	exts     []string // valid file name extensions in lower case
+	notFound error    // returned by sources that don't have a file
+}
+
+// isFile reports if name has a valid extension.
+func (k resourceKind) isFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range k.exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// validFileName reports if name may be used
+// to store or look up a file.
+func (k resourceKind) validFileName(name string) bool {
+	return k.isFile(name) && name == filepath.Base(name) &&
+		!strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\|`)
+}
+
+// sources returns a ResourceSource trying srcs in order.
+// Sources are skipped only if they return the not found error of k.
+func (k resourceKind) sources(srcs ...ResourceSource) ResourceSource {
+	return func(name string) ([]byte, error) {
+		for _, src := range srcs {
+			if src == nil {
+				continue
+			}
+			raw, err := src(name)
+			if err != k.notFound {
+				return raw, err
+			}
+		}
+		return nil, errors.Errorf("%s %q not found", k.name, name)
+	}
+}
+
+// dir returns a ResourceSource reading files from dir.
+func (k resourceKind) dir(dir string) ResourceSource {
+	return func(name string) ([]byte, error) {
+		if !k.validFileName(name) {
+			return nil, k.notFound
+		}
+		raw, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			return nil, k.notFound
+		}
+		return raw, err
+	}
+}
+
+// files returns a ResourceSource serving files from m.
+func (k resourceKind) files(m map[string][]byte) ResourceSource {
+	return func(name string) ([]byte, error) {
+		raw, ok := m[name]
+		if !ok {
+			return nil, k.notFound
+		}
+		return raw, nil
+	}
+}
+
+// db returns a ResourceSource reading files from db
+// stored at the keys returned by key.
+func (k resourceKind) db(db keyvalue.DB, key func(name string) string) ResourceSource {
+	return func(name string) ([]byte, error) {
+		raw, err := db.Get(key(name))
+		if err == keyvalue.ErrNotFound {
+			return nil, k.notFound
+		}
+		return raw, err
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestResourceSources(t *testing.T) {
+	failing := errors.New("failing source")
+	src := imageSources(
+		nil,
+		imageMap(map[string][]byte{"a.png": []byte("map a")}),
+		func(name string) ([]byte, error) {
+			if name == "c.png" {
+				return nil, failing
+			}
+			return nil, errImageNotFound
+		},
+		imageDir("testdata-missing"),
+		imageMap(map[string][]byte{"a.png": []byte("late a"), "b.png": []byte("map b")}),
+	)
+
+	tests := []struct {
+		name string
+		want string
+		err  string
+	}{
+		{"a.png", "map a", ""},
+		{"b.png", "map b", ""},
+		{"c.png", "", "failing source"},
+		{"d.png", "", `image "d.png" not found`},
+	}
+	for _, x := range tests {
+		raw, err := src(x.name)
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+		if string(raw) != x.want || got != x.err {
+			t.Errorf("%s: got %q, %v; want %q, %q", x.name, raw, err, x.want, x.err)
+		}
+	}
+
+	for _, name := range []string{"a.png", "A.PNG", "logo.ttf", "../a.png", ".png", "a|b.png"} {
+		want := name == "a.png" || name == "A.PNG"
+		if got := validImageFileName(name); got != want {
+			t.Errorf("validImageFileName(%q) = %v, want %v", name, got, want)
+		}
+		if got := validFontFileName(name); got != (name == "logo.ttf") {
+			t.Errorf("validFontFileName(%q) = %v", name, got)
+		}
+	}
+}
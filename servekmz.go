@@ -23,16 +23,33 @@ func writeKMZ(w io.Writer, db keyvalue.DB, mm mapMeta) error {
 	}
 
 	kmz := NewKMZ(w, mm.Title)
+
+	legend, err := db.Get("path|" + path.Join(mm.Key, legendPNG))
+	switch err {
+	case nil:
+		if err := kmz.ScreenOverlay(legend, "Legend"); err != nil {
+			return err
+		}
+	case keyvalue.ErrNotFound:
+		// map without legend
+	default:
+		return err
+	}
+
 	for _, p := range pubs {
 		iconKey := "path|" + path.Join(mm.Key, p.IconBasename())
-		icon, err := db.Get(iconKey)
+		icon, err := getPath(db, iconKey)
 		if err != nil {
 			return err
 		}
 
+		desc := p.Addr + "\n"
+		if p.Hours != nil {
+			desc += p.Hours.Src + "\n"
+		}
 		pm := Placemark{
 			Title: fmt.Sprintf("[%s] %s", p.Label, p.Title),
-			Desc:  p.Addr + "\n" + strings.Join(p.Desc, "\n"),
+			Desc:  desc + strings.Join(p.Desc, "\n"),
 			Lat:   p.Geo.Lat,
 			Long:  p.Geo.Long,
 		}
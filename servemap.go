@@ -42,9 +42,11 @@ func mapHandler(res, googlemapsapikey string, mdb *mapDB) http.Handler {
 			return
 		}
 
-		if p == "/"+pubjson || strings.HasPrefix(p, "/icon-") {
+		sprite := strings.HasPrefix(p, "/sprites-")
+		if p == "/"+pubjson || p == "/"+legendJSON || p == "/"+legendPNG ||
+			strings.HasPrefix(p, "/icon-") || sprite {
 			k := "path|" + path.Join(mm.Key, p)
-			raw, err := mdb.db.Get(k)
+			raw, err := getPath(mdb.db, k)
 			if err != nil {
 				log.Printf("data access %v: %v", k, err)
 				if err == keyvalue.ErrNotFound {
@@ -54,6 +56,9 @@ func mapHandler(res, googlemapsapikey string, mdb *mapDB) http.Handler {
 				}
 				return
 			}
+			if sprite {
+				w.Header().Set("Cache-Control", spriteCacheControl)
+			}
 			http.ServeContent(w, req, path.Base(p), mm.ModTime, bytes.NewReader(raw))
 			return
 		}
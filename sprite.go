@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+// spriteGap is the space between icons in sprite sheets in CSS pixels,
+// so neighbours don't bleed into icons when scaled.
+const spriteGap = 1
+
+// spriteCacheControl is used for sprite sheets,
+// whose names change with their content.
+const spriteCacheControl = "public, max-age=31536000, immutable"
+
+// spriteSheet packs the icons of pubs into a single image
+// for each pixel ratio.
+type spriteSheet struct {
+	pos  []image.Point // icon positions in CSS pixels
+	w, h int           // sheet size in CSS pixels
+
+	sheets map[int]*image.RGBA // sheets by pixel ratio scale
+
+	name string // base name set by encode
+}
+
+// newSpriteSheet returns a sprite sheet for icons of the given sizes
+// in CSS pixels.
+//
+// Icons are packed in rows of a sheet about as wide as high,
+// from the largest to the smallest.
+func newSpriteSheet(sizes []int) *spriteSheet {
+	order := make([]int, len(sizes))
+	var area, maxSize int
+	for i, size := range sizes {
+		order[i] = i
+		area += (size + spriteGap) * (size + spriteGap)
+		if size > maxSize {
+			maxSize = size
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return sizes[order[i]] > sizes[order[j]]
+	})
+
+	width := int(math.Ceil(math.Sqrt(float64(area))))
+	if width < maxSize {
+		width = maxSize
+	}
+
+	s := &spriteSheet{
+		pos:    make([]image.Point, len(sizes)),
+		sheets: make(map[int]*image.RGBA),
+	}
+	var x, y, rowh int
+	for _, i := range order {
+		size := sizes[i]
+		if x != 0 && x+size > width {
+			x, y = 0, y+rowh+spriteGap
+			rowh = 0
+		}
+		s.pos[i] = image.Pt(x, y)
+		if x+size > s.w {
+			s.w = x + size
+		}
+		if size > rowh {
+			rowh = size
+		}
+		x += size + spriteGap
+	}
+	s.h = y + rowh
+	return s
+}
+
+// draw draws im as the icon i for the pixel ratio scale.
+func (s *spriteSheet) draw(i, scale int, im image.Image) {
+	sheet, ok := s.sheets[scale]
+	if !ok {
+		sheet = image.NewRGBA(image.Rect(0, 0, s.w*scale, s.h*scale))
+		s.sheets[scale] = sheet
+	}
+	b := im.Bounds()
+	p := s.pos[i].Mul(scale)
+	draw.Draw(sheet, b.Sub(b.Min).Add(p), im, b.Min, draw.Src)
+}
+
+// encode returns the PNG images of the sheets by file name.
+// The names include a hash of the content,
+// so the sheets may be cached indefinitely.
+func (s *spriteSheet) encode() (map[string][]byte, error) {
+	data := make(map[int][]byte)
+	h := sha256.New()
+	for _, scale := range iconScales {
+		sheet, ok := s.sheets[scale]
+		if !ok {
+			continue
+		}
+		raw, err := encodePNG(sheet)
+		if err != nil {
+			return nil, err
+		}
+		data[scale] = raw
+		h.Write(raw)
+	}
+	s.name = "sprites-" + hex.EncodeToString(h.Sum(nil)[:8])
+
+	files := make(map[string][]byte)
+	for scale, raw := range data {
+		files[s.variantName(scale)] = raw
+	}
+	return files, nil
+}
+
+// variantName returns the file name of the sheet for the pixel ratio scale,
+// named like pub icons.
+func (s *spriteSheet) variantName(scale int) string {
+	if scale == 2 {
+		return s.name + ".png"
+	}
+	return fmt.Sprintf("%s@%dx.png", s.name, scale)
+}
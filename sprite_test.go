@@ -0,0 +1,52 @@
+package main
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestSpriteSheet(t *testing.T) {
+	tests := [][]int{
+		{28},
+		{28, 28, 28, 28, 28},
+		{28, 40, 28, 128, 20, 28, 40},
+		{20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20},
+	}
+
+	for _, sizes := range tests {
+		s := newSpriteSheet(sizes)
+		sheet := image.Rect(0, 0, s.w, s.h)
+		rects := make([]image.Rectangle, len(sizes))
+		for i, size := range sizes {
+			r := image.Rectangle{s.pos[i], s.pos[i].Add(image.Pt(size, size))}
+			if !r.In(sheet) {
+				t.Errorf("%v: icon %d at %v outside sheet %v", sizes, i, r, sheet)
+			}
+			for j, o := range rects[:i] {
+				if r.Inset(-spriteGap).Overlaps(o) {
+					t.Errorf("%v: icon %d at %v overlaps %d at %v", sizes, i, r, j, o)
+				}
+			}
+			rects[i] = r
+		}
+
+		for i, size := range sizes {
+			for _, scale := range iconScales {
+				s.draw(i, scale, image.NewRGBA(image.Rect(0, 0, size*scale, size*scale)))
+			}
+		}
+		files, err := s.encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != len(iconScales) {
+			t.Errorf("%v: got %d sheets, want %d", sizes, len(files), len(iconScales))
+		}
+		for name := range files {
+			if !strings.HasPrefix(name, "sprites-") || !strings.HasSuffix(name, ".png") {
+				t.Errorf("%v: invalid sheet name %q", sizes, name)
+			}
+		}
+	}
+}
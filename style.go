@@ -1,16 +1,24 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"image"
 	"image/color"
 	"io"
-	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
 
+	"github.com/golang/freetype/truetype"
 	"github.com/pkg/errors"
 	"github.com/tajtiattila/beermap/icon"
 )
@@ -20,16 +28,102 @@ type Style struct {
 	Ignore bool // ignore this style
 	Cond   Cond // condition to use this style
 
-	Shape icon.Drawable
-	Color color.Color // shape fill
+	Font string // font name, empty means the default font
+
+	Label *template.Template // label template, nil means the global one
+
+	Size int // marker size in CSS pixels, zero means the global size
+
+	Shape   icon.Drawable
+	Color   color.Color // shape fill
+	Outline color.Color // shape outline
+	Text    color.Color // label text, nil means contrasting with fill
+	Shadow  color.Color
+	Opacity float64 // opacity of the whole icon
+
+	DropShadow *icon.Effect
+	Glow       *icon.Effect
+
+	Recency *recencyShade // optional fill shading by last visit
+
+	// Badge, if set, makes this a badge style
+	// drawn over the icon of the first matching regular style.
+	Badge *icon.Badge
+
+	// set records the properties specified for this style
+	set styleProps
+
+	// shapeKey identifies Shape in render cache keys,
+	// empty if icons of this style should not be cached
+	shapeKey string
+
+	// imageShape is set if Shape is a bitmap image
+	imageShape bool
 }
 
+// styleProps is a set of style properties.
+type styleProps uint
+
+const (
+	propFont styleProps = 1 << iota
+	propLabel
+	propSize
+	propShape
+	propColor
+	propOutline
+	propText
+	propShadow
+	propOpacity
+	propDropShadow
+	propGlow
+	propRecency
+)
+
+// defaultIconSize is the default marker size in CSS pixels.
+// Icons are rendered at 1x, 2x and 3x pixel ratios.
+const defaultIconSize = 28
+
+// maxIconSize is the largest marker size accepted.
+const maxIconSize = 128
+
 type Styler struct {
 	r *icon.Renderer
 
+	// fonts holds renderers for fonts of individual styles
+	fonts map[string]*icon.Renderer
+
+	// fontKeys identifies the fonts of renderers in render cache keys
+	fontKeys map[*icon.Renderer]string
+
 	styles []Style
 
+	// cascade means that all matching styles contribute properties,
+	// instead of only the first matching style being used
+	cascade bool
+
+	// cascadeOrder holds the indices of styles in the order
+	// they are applied in cascade mode
+	cascadeOrder []int
+
 	niceLabel bool
+
+	// label is the global label template, nil means the pub label
+	label *template.Template
+
+	// size is the marker size in CSS pixels, zero means defaultIconSize
+	size int
+
+	// svg means vector icons are generated besides raster ones
+	svg bool
+
+	// sprites means icons are also packed into sprite sheets
+	sprites bool
+
+	// timeZone is the IANA time zone name of the map, if specified.
+	timeZone string
+
+	// now returns the current time for recency shading
+	now func() time.Time
 }
 
 func NewStylerPath(fn string) (*Styler, error) {
@@ -39,147 +133,701 @@ func NewStylerPath(fn string) (*Styler, error) {
 	}
 	defer f.Close()
 
-	return NewStyler(f, func(fontname string) ([]byte, error) {
-		return ioutil.ReadFile(filepath.Join(filepath.Dir(fn), fontname))
-	})
+	dir := filepath.Dir(fn)
+	return NewStyler(f, fontDir(dir), imageSources(imageDir(dir)))
 }
 
-func NewStyler(r io.Reader, readFont func(fn string) ([]byte, error)) (*Styler, error) {
+func NewStyler(r io.Reader, readFont FontSource, readImage ImageSource) (*Styler, error) {
 	var j struct {
-		Font      string  `json:"font"`
-		Styles    []Style `json:"styles"`
-		NiceLabel bool    `json:"niceLabel"`
+		Font       string                 `json:"font"`
+		Fallback   []string               `json:"fallbackFonts"`
+		Mode       string                 `json:"mode"`
+		Label      string                 `json:"label"`
+		Size       int                    `json:"size"`
+		SVG        bool                   `json:"svg"`
+		Sprites    bool                   `json:"sprites"`
+		Conditions map[string]interface{} `json:"conditions"`
+		Styles     []jStyle               `json:"styles"`
+		NiceLabel  bool                   `json:"niceLabel"`
+		TimeZone   string                 `json:"timeZone"`
 	}
 	if err := json.NewDecoder(r).Decode(&j); err != nil {
 		return nil, err
 	}
-	font, err := readFont(j.Font)
+	var cascade bool
+	switch j.Mode {
+	case "", "first":
+	case "cascade":
+		cascade = true
+	default:
+		return nil, errors.Errorf("unknown mode %q", j.Mode)
+	}
+	var loc *time.Location
+	if j.TimeZone != "" {
+		var err error
+		loc, err = time.LoadLocation(j.TimeZone)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid time zone")
+		}
+	}
+	env, err := newCondEnv(j.Conditions, loc)
 	if err != nil {
 		return nil, err
 	}
-	iconr, err := icon.NewRendererFont(font)
+	if err := checkIconSize(j.Size); err != nil {
+		return nil, err
+	}
+	var label *template.Template
+	if j.Label != "" {
+		label, err = parseLabelTemplate(j.Label)
+		if err != nil {
+			return nil, err
+		}
+	}
+	styles := make([]Style, len(j.Styles))
+	for i, js := range j.Styles {
+		styles[i], err = js.decode(env, readImage, cascade)
+		if err != nil {
+			return nil, errors.Wrapf(err, "style %s", js.ident(i))
+		}
+	}
+	fallback, err := loadFallbackFonts(j.Fallback, readFont)
 	if err != nil {
-		return nil, errors.Wrap(err, "can't init icon renderer")
+		return nil, errors.Wrap(err, "fallback font")
 	}
-	return &Styler{
-		r:         iconr,
-		styles:    j.Styles,
-		niceLabel: j.NiceLabel,
-	}, nil
+	iconr, fontKey, err := newFontRenderer(j.Font, fallback, readFont)
+	if err != nil {
+		return nil, err
+	}
+	st := &Styler{
+		r:            iconr,
+		fonts:        make(map[string]*icon.Renderer),
+		fontKeys:     map[*icon.Renderer]string{iconr: fontKey},
+		styles:       styles,
+		cascade:      cascade,
+		cascadeOrder: cascadeOrder(styles),
+		niceLabel:    j.NiceLabel,
+		label:        label,
+		size:         j.Size,
+		svg:          j.SVG,
+		sprites:      j.Sprites,
+		timeZone:     j.TimeZone,
+		now:          env.clock(),
+	}
+	for i, s := range styles {
+		if s.Font == "" || s.Font == j.Font {
+			continue
+		}
+		if _, ok := st.fonts[s.Font]; ok {
+			continue
+		}
+		r, fontKey, err := newFontRenderer(s.Font, fallback, readFont)
+		if err != nil {
+			return nil, errors.Wrapf(err, "style %s", j.Styles[i].ident(i))
+		}
+		st.fonts[s.Font] = r
+		st.fontKeys[r] = fontKey
+	}
+	return st, nil
+}
+
+// fallbackFonts are fonts parsed once and shared by all renderers of a Styler.
+type fallbackFonts struct {
+	fonts []*truetype.Font
+	sum   []byte // hash of the hashes of the font data
+}
+
+// loadFallbackFonts reads and parses the named fonts.
+func loadFallbackFonts(names []string, readFont FontSource) (fallbackFonts, error) {
+	var fb fallbackFonts
+	h := sha256.New()
+	for _, name := range names {
+		raw, err := readFont(name)
+		if err != nil {
+			return fallbackFonts{}, err
+		}
+		f, err := icon.ParseFont(raw)
+		if err != nil {
+			return fallbackFonts{}, errors.Wrapf(err, "font %q", name)
+		}
+		fb.fonts = append(fb.fonts, f)
+		sum := sha256.Sum256(raw)
+		h.Write(sum[:])
+	}
+	fb.sum = h.Sum(nil)
+	return fb, nil
+}
+
+// newFontRenderer returns an icon renderer using the named font
+// followed by the fallback fonts, and a hash of the font data.
+func newFontRenderer(name string, fallback fallbackFonts, readFont FontSource) (*icon.Renderer, string, error) {
+	raw, err := readFont(name)
+	if err != nil {
+		return nil, "", err
+	}
+	font, err := icon.ParseFont(raw)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "can't init icon renderer for font %q", name)
+	}
+	r, err := icon.NewRendererTrueType(append([]*truetype.Font{font}, fallback.fonts...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(raw)
+	h := sha256.New()
+	h.Write(sum[:])
+	h.Write(fallback.sum)
+	return r, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// renderer returns the icon renderer for s.
+func (st *Styler) renderer(s Style) *icon.Renderer {
+	if r, ok := st.fonts[s.Font]; ok {
+		return r
+	}
+	return st.r
 }
 
 func (st *Styler) Visible(p Pub) bool {
+	if st.cascade {
+		s, ok := st.cascadeStyle(p)
+		return !ok || s.Shape != nil
+	}
 	for _, s := range st.styles {
-		if !s.Ignore && s.Cond.Accept(p) && s.Shape == nil {
+		if !s.Ignore && s.Badge == nil && s.Cond.Accept(p) && s.Shape == nil {
 			return false
 		}
 	}
 	return true
 }
 
+// PubIcon returns the icon of p at pixel ratio 2.
 func (st *Styler) PubIcon(p Pub) image.Image {
+	return st.PubIconScale(p, 2)
+}
+
+// PubIconScale returns the icon of p for the pixel ratio scale.
+func (st *Styler) PubIconScale(p Pub, scale int) image.Image {
+	return st.pubJob(p, scale).render()
+}
+
+// PubIconSVG returns the icon of p as an SVG document.
+// It is drawn like the icon at pixel ratio 2, and scales to any size.
+func (st *Styler) PubIconSVG(p Pub) ([]byte, error) {
+	job := st.pubJob(p, 2)
+	return job.svg(float64(job.r.Dim+2*job.r.Margin) / 2)
+}
+
+// pubJob returns the job rendering the icon of p for the pixel ratio scale.
+func (st *Styler) pubJob(p Pub, scale int) iconJob {
+	s, ok := st.pubStyle(p)
+	label := st.pubLabel(p, s)
+	dim := st.iconSize(s) * scale
+	if !ok {
+		s = cascadeBase()
+		s.Shape, s.shapeKey = icon.Square, "square"
+		return st.styleJob(s, s.Color, label, dim, st.pubBadges(p))
+	}
+	return st.styleJob(s, st.pubFill(p, s), label, dim, st.pubBadges(p))
+}
+
+// pubFill returns the fill color of p using style s.
+func (st *Styler) pubFill(p Pub, s Style) color.Color {
+	if s.Recency != nil {
+		return s.Recency.color(p, st.clock(), s.Color)
+	}
+	return s.Color
+}
+
+// renderStyle renders an icon of size dim using s with fill color and badges.
+func (st *Styler) renderStyle(s Style, fill color.Color, label string, dim int, badges []icon.Badge) image.Image {
+	return st.styleJob(s, fill, label, dim, badges).render()
+}
+
+// styleJob returns the job rendering an icon of size dim
+// using s with fill color and badges.
+// The image has the effect margin of s around the icon.
+func (st *Styler) styleJob(s Style, fill color.Color, label string, dim int, badges []icon.Badge) iconJob {
+	r := st.renderer(s)
+	size := st.iconSize(s)
+	margin := (st.effectMargin(s)*dim + size - 1) / size
+	return iconJob{
+		r:        r.WithDim(dim).WithMargin(margin),
+		fontKey:  st.fontKeys[r],
+		shape:    s.Shape,
+		shapeKey: s.shapeKey,
+		colors:   s.colors(fill),
+		label:    label,
+		effects:  scaleEffects(s.effects(), float64(dim)/float64(r.Dim)),
+		badges:   badges,
+		opacity:  s.Opacity,
+	}
+}
+
+// PubIconSize returns the marker size of p in CSS pixels.
+func (st *Styler) PubIconSize(p Pub) int {
+	s, _ := st.pubStyle(p)
+	return st.markerSize(s)
+}
+
+// markerSize returns the size of icon images of style s in CSS pixels,
+// including the margin for effects.
+func (st *Styler) markerSize(s Style) int {
+	return st.iconSize(s) + 2*st.effectMargin(s)
+}
+
+// effectMargin returns the space needed around icons of style s
+// for its effects in CSS pixels.
+// It is large enough at each of iconScales, so the images
+// at all scales have the same size in CSS pixels.
+func (st *Styler) effectMargin(s Style) int {
+	effects := s.effects()
+	if len(effects) == 0 {
+		return 0
+	}
+	size := st.iconSize(s)
+	var m int
+	for _, scale := range iconScales {
+		dim := size * scale
+		pm := icon.EffectMargin(scaleEffects(effects, float64(dim)/float64(st.renderer(s).Dim)))
+		if v := (pm + scale - 1) / scale; v > m {
+			m = v
+		}
+	}
+	return m
+}
+
+// iconSize returns the marker size of style s in CSS pixels.
+func (st *Styler) iconSize(s Style) int {
+	switch {
+	case s.Size != 0:
+		return s.Size
+	case st.size != 0:
+		return st.size
+	}
+	return defaultIconSize
+}
+
+// scaleEffects returns effects scaled by f.
+// Effects are specified for icons rendered at the default size at 2x.
+func scaleEffects(effects []icon.Effect, f float64) []icon.Effect {
+	scaled := make([]icon.Effect, len(effects))
+	for i, e := range effects {
+		scaled[i] = e.Scaled(f)
+	}
+	return scaled
+}
+
+func checkIconSize(size int) error {
+	if size < 0 || size > maxIconSize {
+		return errors.Errorf("icon size %d out of range", size)
+	}
+	return nil
+}
+
+// pubLabel returns the label of p in the icon using style s.
+func (st *Styler) pubLabel(p Pub, s Style) string {
 	label := p.Label
 	if st.niceLabel {
 		if n, err := strconv.Atoi(label); err == nil {
 			label = fmt.Sprint(n)
 		}
 	}
+	t := s.Label
+	if t == nil {
+		t = st.label
+	}
+	if t == nil {
+		return label
+	}
+	l, err := execLabel(t, p, label)
+	if err != nil {
+		log.Println(err)
+		return label
+	}
+	return l
+}
+
+// PubAnchor returns the anchor point of the icon of p
+// as a fraction of the icon size, or false if the icon
+// should be anchored at its bottom center.
+// Icons with an effect margin are anchored at the bottom center
+// of the shape within the margin.
+func (st *Styler) PubAnchor(p Pub) (x, y float64, ok bool) {
+	s, ok := st.pubStyle(p)
+	if !ok {
+		return 0, 0, false
+	}
+	r := st.renderer(s)
+	m := st.effectMargin(s)
+	pt, ok := r.Anchor(s.Shape)
+	if !ok {
+		if m == 0 {
+			return 0, 0, false
+		}
+		pt = image.Pt(r.Dim/2, r.Dim)
+	}
+	// anchor in CSS pixels within the margin
+	f := float64(st.iconSize(s)) / float64(r.Dim)
+	total := float64(st.markerSize(s))
+	return (float64(m) + float64(pt.X)*f) / total, (float64(m) + float64(pt.Y)*f) / total, true
+}
+
+// pubStyle returns the style to use for p.
+func (st *Styler) pubStyle(p Pub) (Style, bool) {
+	if st.cascade {
+		return st.cascadeStyle(p)
+	}
 	for _, s := range st.styles {
-		if !s.Ignore && s.Cond.Accept(p) {
-			return st.r.Render(s.Shape, icon.SimpleColors(s.Color), label)
+		if !s.Ignore && s.Badge == nil && s.Cond.Accept(p) {
+			return s, true
 		}
 	}
-	return st.r.Render(icon.Square, icon.SimpleColors(color.Black), label)
+	return Style{}, false
 }
 
-func (s *Style) UnmarshalJSON(p []byte) error {
-	var j jStyle
-	if err := json.Unmarshal(p, &j); err != nil {
-		return err
+// cascadeStyle returns the style of p combining the properties
+// of all matching styles, more specific and later styles overriding others.
+// It returns false if no matching style specifies the shape.
+func (st *Styler) cascadeStyle(p Pub) (Style, bool) {
+	s := cascadeBase()
+	for _, i := range st.cascadeOrder {
+		if x := st.styles[i]; !x.Ignore && x.Badge == nil && x.Cond.Accept(p) {
+			s.merge(x)
+		}
 	}
+	s.imageDefaults()
+	return s, s.set&propShape != 0
+}
 
-	s.Name = j.Name
-	s.Ignore = j.Ignore
+// cascadeOrder returns the indices of styles ordered by
+// the specificity of their conditions, keeping the order of
+// styles having the same specificity.
+func cascadeOrder(styles []Style) []int {
+	order := make([]int, len(styles))
+	spec := make([]int, len(styles))
+	for i, s := range styles {
+		order[i] = i
+		spec[i] = condSpecificity(s.Cond)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return spec[order[i]] < spec[order[j]]
+	})
+	return order
+}
 
-	var err error
-	s.Cond, err = decodeCond(j.Cond)
-	if err != nil {
-		return err
+// cascadeBase returns the style with the properties used in cascade mode
+// when no matching style sets them.
+func cascadeBase() Style {
+	def := icon.SimpleColors(color.Black)
+	return Style{
+		Color:   def.Fill,
+		Outline: def.Outline,
+		Text:    def.Text,
+		Shadow:  def.Shadow,
+		Opacity: 1,
 	}
+}
 
-	switch j.Shape {
-	case "circle":
-		s.Shape = icon.Circle
-	case "square":
-		s.Shape = icon.Square
-	case "none":
-		// ignore color
-		return nil
-	case "":
-		return errors.New("missing shape")
-	default:
-		return errors.Errorf("unknown shape %q", j.Shape)
+// standalone returns s of a cascade to be shown on its own,
+// with its unset properties taken from cascadeBase,
+// and a circle shape if it has none.
+func standalone(s Style) Style {
+	x := cascadeBase()
+	x.Name, x.Ignore, x.Cond = s.Name, s.Ignore, s.Cond
+	x.merge(s)
+	if x.set&propShape == 0 {
+		x.Shape = icon.Circle
 	}
+	x.imageDefaults()
+	return x
+}
 
-	s.Color, err = decodeColor(j.Color)
-	if err != nil {
-		return err
+// merge sets the properties of s specified in x.
+func (s *Style) merge(x Style) {
+	if x.set&propFont != 0 {
+		s.Font = x.Font
+	}
+	if x.set&propLabel != 0 {
+		s.Label = x.Label
+	}
+	if x.set&propSize != 0 {
+		s.Size = x.Size
+	}
+	if x.set&propShape != 0 {
+		s.Shape, s.shapeKey, s.imageShape = x.Shape, x.shapeKey, x.imageShape
+	}
+	if x.set&propColor != 0 {
+		s.Color = x.Color
+	}
+	if x.set&propOutline != 0 {
+		s.Outline = x.Outline
+	}
+	if x.set&propText != 0 {
+		s.Text = x.Text
+	}
+	if x.set&propShadow != 0 {
+		s.Shadow = x.Shadow
 	}
+	if x.set&propOpacity != 0 {
+		s.Opacity = x.Opacity
+	}
+	if x.set&propDropShadow != 0 {
+		s.DropShadow = x.DropShadow
+	}
+	if x.set&propGlow != 0 {
+		s.Glow = x.Glow
+	}
+	if x.set&propRecency != 0 {
+		s.Recency = x.Recency
+	}
+	s.set |= x.set
+}
 
-	return nil
+// imageDefaults sets the fill of image shapes to white
+// if no style specified it, because it is used only for tinting.
+func (s *Style) imageDefaults() {
+	if s.imageShape && s.set&propColor == 0 {
+		s.Color = color.White
+	}
 }
 
-func decodeOptionalColor(s string, def color.Color) (color.Color, error) {
-	if s == "" {
-		return def, nil
+// effects returns the effects of s in drawing order.
+func (s Style) effects() []icon.Effect {
+	var effects []icon.Effect
+	if s.DropShadow != nil {
+		effects = append(effects, *s.DropShadow)
 	}
-	return decodeColor(s)
+	if s.Glow != nil {
+		effects = append(effects, *s.Glow)
+	}
+	return effects
 }
 
-func decodeColor(s string) (color.Color, error) {
-	if s == "" {
-		return nil, errors.New("empty color spec")
+// pubBadges returns the badges to draw over the icon of p.
+func (st *Styler) pubBadges(p Pub) []icon.Badge {
+	var badges []icon.Badge
+	for _, s := range st.styles {
+		if !s.Ignore && s.Badge != nil && s.Cond.Accept(p) {
+			badges = append(badges, *s.Badge)
+		}
+	}
+	return badges
+}
+
+// colors returns the icon colors of s using fill.
+func (s Style) colors(fill color.Color) icon.Colors {
+	c := icon.Colors{
+		Outline: s.Outline,
+		Fill:    fill,
+		Shadow:  s.Shadow,
+		Text:    s.Text,
+	}
+	if c.Text == nil {
+		c.Text = contrastColor(fill)
 	}
+	return c
+}
 
-	if s[0] != '#' || (len(s) != 4 && len(s) != 7) {
-		return nil, errors.Errorf("invalid color spec %q", s)
+func (st *Styler) clock() time.Time {
+	if st.now == nil {
+		return time.Now()
+	}
+	return st.now()
+}
+
+// decode decodes the style. In cascade mode properties are optional,
+// and only those specified are recorded in the set of the style.
+func (j *jStyle) decode(env *condEnv, readImage ImageSource, cascade bool) (Style, error) {
+	s := Style{
+		Name:    j.Name,
+		Ignore:  j.Ignore,
+		Font:    j.Font,
+		Opacity: 1,
+	}
+	if j.Font != "" {
+		s.set |= propFont
 	}
 
-	v, err := hexDigits(s[1:])
+	var err error
+	s.Cond, err = decodeCond(j.Cond, env)
 	if err != nil {
-		return nil, errors.Wrapf(err, "invalid color spec %q", s)
+		return s, err
 	}
 
-	var r, g, b uint8
-	if len(v) == 3 {
-		// eg #6f2
-		r = v[0] * 0x11
-		g = v[1] * 0x11
-		b = v[2] * 0x11
-	} else {
-		// eg #66ff22
-		r = v[0]<<4 + v[1]
-		g = v[2]<<4 + v[3]
-		b = v[4]<<4 + v[5]
+	if j.Badge != nil {
+		if p := j.iconProp(); p != "" {
+			return s, errors.Errorf("badge can't be combined with %s", p)
+		}
+		s.Badge, err = j.Badge.decode()
+		return s, errors.Wrap(err, "badge")
+	}
+
+	if j.Label != "" {
+		s.Label, err = parseLabelTemplate(j.Label)
+		if err != nil {
+			return s, err
+		}
+		s.set |= propLabel
+	}
+
+	if j.Size != 0 {
+		if err := checkIconSize(j.Size); err != nil {
+			return s, err
+		}
+		s.Size = j.Size
+		s.set |= propSize
+	}
+
+	if !j.Shape.empty() || !cascade {
+		s.Shape, err = j.Shape.decode(readImage)
+		if err != nil {
+			return s, err
+		}
+		s.shapeKey, err = j.Shape.key()
+		if err != nil {
+			return s, err
+		}
+		s.imageShape = j.Shape.Image != nil
+		s.set |= propShape
+		if s.Shape == nil && !cascade {
+			// shape "none", ignore color
+			return s, nil
+		}
+	}
+
+	switch {
+	case j.Color != "":
+		s.Color, err = decodeColor(j.Color)
+		if err != nil {
+			return s, err
+		}
+		s.set |= propColor
+	case cascade:
+	case j.Shape.Image != nil:
+		// color is used only for tinting images
+		s.Color = color.White
+	default:
+		return s, errors.New("missing color")
+	}
+
+	def := icon.SimpleColors(s.Color)
+	if j.Outline != "" || !cascade {
+		s.Outline, err = decodeOptionalColor(j.Outline, def.Outline)
+		if err != nil {
+			return s, errors.Wrap(err, "outline")
+		}
+		s.set |= propOutline
+	}
+	if j.Text != "" || !cascade {
+		if j.Text != "auto" {
+			s.Text, err = decodeOptionalColor(j.Text, def.Text)
+			if err != nil {
+				return s, errors.Wrap(err, "text")
+			}
+		}
+		s.set |= propText
+	}
+	if j.Shadow != "" || !cascade {
+		s.Shadow, err = decodeOptionalColor(j.Shadow, def.Shadow)
+		if err != nil {
+			return s, errors.Wrap(err, "shadow")
+		}
+		s.set |= propShadow
+	}
+
+	if j.DropShadow != nil {
+		e, err := j.DropShadow.decode()
+		if err != nil {
+			return s, errors.Wrap(err, "dropShadow")
+		}
+		s.DropShadow = &e
+		s.set |= propDropShadow
+		if j.Shadow == "" {
+			// replaces simple shadow unless given explicitly
+			s.Shadow = color.Transparent
+			s.set |= propShadow
+		}
+	}
+
+	if j.Glow != nil {
+		e, err := j.Glow.decode()
+		if err != nil {
+			return s, errors.Wrap(err, "glow")
+		}
+		s.Glow = &e
+		s.set |= propGlow
 	}
-	return color.NRGBA{r, g, b, 0xff}, nil
-}
 
-func hexDigits(s string) ([]byte, error) {
-	var v []byte
-	for _, r := range s {
-		switch {
-		case '0' <= r && r <= '9':
-			v = append(v, byte(r-'0'))
-		case 'a' <= r && r <= 'f':
-			v = append(v, byte(r-'a'+10))
-		case 'A' <= r && r <= 'F':
-			v = append(v, byte(r-'A'+10))
-		default:
-			return nil, errors.Errorf("invalid hex digit %q", r)
+	if j.Opacity != nil {
+		s.Opacity = *j.Opacity
+		if s.Opacity < 0 || s.Opacity > 1 {
+			return s, errors.Errorf("opacity %v out of range", s.Opacity)
 		}
+		s.set |= propOpacity
 	}
-	return v, nil
+
+	if j.Recency != nil {
+		s.Recency, err = j.Recency.decode()
+		if err != nil {
+			return s, err
+		}
+		s.set |= propRecency
+	}
+
+	return s, nil
+}
+
+// iconProp returns the name of the first icon property set in j,
+// or an empty string if there is none.
+func (j *jStyle) iconProp() string {
+	switch {
+	case j.Font != "":
+		return "font"
+	case j.Label != "":
+		return "label"
+	case j.Size != 0:
+		return "size"
+	case !j.Shape.empty():
+		return "shape"
+	case j.Color != "":
+		return "color"
+	case j.Outline != "":
+		return "outline"
+	case j.Text != "":
+		return "text"
+	case j.Shadow != "":
+		return "shadow"
+	case j.Opacity != nil:
+		return "opacity"
+	case j.DropShadow != nil:
+		return "dropShadow"
+	case j.Glow != nil:
+		return "glow"
+	case j.Recency != nil:
+		return "recency"
+	}
+	return ""
+}
+
+// ident identifies the style at index i in error messages.
+func (j *jStyle) ident(i int) string {
+	if j.Name != "" {
+		return strconv.Quote(j.Name)
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// contrastColor returns black or white,
+// whichever is more readable over c.
+func contrastColor(c color.Color) color.Color {
+	r, g, b, _ := color.NRGBAModel.Convert(c).RGBA()
+	// relative luminance, ITU-R BT.709
+	y := 0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)
+	if y > 0.6*0xffff {
+		return color.Black
+	}
+	return color.White
 }
 
 func jsstring(m map[string]interface{}, key string) (string, bool) {
@@ -198,6 +846,266 @@ type jStyle struct {
 
 	Cond interface{} `json:"cond"`
 
-	Shape string `json:"shape"`
-	Color string `json:"color"`
+	Font string `json:"font"`
+
+	Label string `json:"label"` // label template
+
+	Size int `json:"size"` // marker size in CSS pixels
+
+	Shape   jShape `json:"shape"`
+	Color   string `json:"color"`
+	Outline string `json:"outline"`
+	Text    string `json:"text"` // color or "auto"
+	Shadow  string `json:"shadow"`
+
+	Opacity *float64 `json:"opacity"`
+
+	DropShadow *jEffect `json:"dropShadow"`
+	Glow       *jEffect `json:"glow"`
+
+	Recency *jRecency `json:"recency"`
+
+	Badge *jBadge `json:"badge"`
+}
+
+type jBadge struct {
+	Mark    string `json:"mark"`
+	Corner  string `json:"corner"`
+	Color   string `json:"color"`
+	Outline string `json:"outline"`
+	Text    string `json:"text"`
+	Letter  string `json:"letter"`
+}
+
+func (j *jBadge) decode() (*icon.Badge, error) {
+	b := new(icon.Badge)
+
+	switch j.Mark {
+	case "dot":
+		b.Mark = icon.DotMark
+	case "cross":
+		b.Mark = icon.CrossMark
+	case "star":
+		b.Mark = icon.StarMark
+	case "letter":
+		b.Mark = icon.LetterMark
+		if utf8.RuneCountInString(j.Letter) != 1 {
+			return nil, errors.Errorf("invalid letter %q", j.Letter)
+		}
+		b.Letter = j.Letter
+	case "":
+		return nil, errors.New("missing mark")
+	default:
+		return nil, errors.Errorf("unknown mark %q", j.Mark)
+	}
+
+	switch j.Corner {
+	case "", "topRight":
+		b.Corner = icon.TopRight
+	case "topLeft":
+		b.Corner = icon.TopLeft
+	case "bottomRight":
+		b.Corner = icon.BottomRight
+	case "bottomLeft":
+		b.Corner = icon.BottomLeft
+	default:
+		return nil, errors.Errorf("unknown corner %q", j.Corner)
+	}
+
+	var err error
+	b.Color, err = decodeColor(j.Color)
+	if err != nil {
+		return nil, err
+	}
+	b.Outline, err = decodeOptionalColor(j.Outline, color.White)
+	if err != nil {
+		return nil, errors.Wrap(err, "outline")
+	}
+	b.Text, err = decodeOptionalColor(j.Text, contrastColor(b.Color))
+	if err != nil {
+		return nil, errors.Wrap(err, "text")
+	}
+	return b, nil
+}
+
+type jEffect struct {
+	Color  string  `json:"color"`
+	Radius float64 `json:"radius"`
+	Offset [2]int  `json:"offset"`
+}
+
+func (j *jEffect) decode() (icon.Effect, error) {
+	c, err := decodeColor(j.Color)
+	if err != nil {
+		return icon.Effect{}, err
+	}
+	if j.Radius < 0 || j.Radius > 16 {
+		return icon.Effect{}, errors.Errorf("radius %v out of range", j.Radius)
+	}
+	for _, v := range j.Offset {
+		if v < -8 || v > 8 {
+			return icon.Effect{}, errors.Errorf("offset %v out of range", v)
+		}
+	}
+	return icon.Effect{
+		Color:  c,
+		Radius: j.Radius,
+		Offset: image.Pt(j.Offset[0], j.Offset[1]),
+	}, nil
+}
+
+// jShape is a shape name, a custom path shape or an image.
+type jShape struct {
+	Name  string
+	Path  *jPathShape
+	Image *jImageShape
+}
+
+func (j *jShape) UnmarshalJSON(p []byte) error {
+	if err := json.Unmarshal(p, &j.Name); err == nil {
+		return nil
+	}
+	var probe struct {
+		Image *string `json:"image"`
+	}
+	if err := json.Unmarshal(p, &probe); err != nil {
+		return err
+	}
+	if probe.Image != nil {
+		j.Image = new(jImageShape)
+		return json.Unmarshal(p, j.Image)
+	}
+	j.Path = new(jPathShape)
+	return json.Unmarshal(p, j.Path)
+}
+
+// empty reports if no shape was specified.
+func (j *jShape) empty() bool {
+	return j.Name == "" && j.Path == nil && j.Image == nil
+}
+
+// key returns a string identifying the decoded shape in render cache keys.
+// Image shapes are identified by the image content hashed by decode.
+func (j *jShape) key() (string, error) {
+	raw, err := json.Marshal(j)
+	if err != nil {
+		return "", err
+	}
+	if j.Image == nil {
+		return string(raw), nil
+	}
+	return fmt.Sprintf("%s %x", raw, j.Image.sum), nil
+}
+
+// decode returns the shape, or nil for shape "none".
+func (j *jShape) decode(readImage ImageSource) (icon.Drawable, error) {
+	if j.Path != nil {
+		d, err := j.Path.decode()
+		return d, errors.Wrap(err, "path shape")
+	}
+	if j.Image != nil {
+		d, err := j.Image.decode(readImage)
+		return d, errors.Wrap(err, "image shape")
+	}
+
+	switch j.Name {
+	case "circle":
+		return icon.Circle, nil
+	case "square":
+		return icon.Square, nil
+	case "roundedSquare":
+		return icon.RoundedSquare, nil
+	case "diamond":
+		return icon.Diamond, nil
+	case "hexagon":
+		return icon.Hexagon, nil
+	case "star":
+		return icon.Star, nil
+	case "triangle":
+		return icon.Triangle, nil
+	case "pin":
+		return icon.Pin, nil
+	case "none":
+		return nil, nil
+	case "":
+		return nil, errors.New("missing shape")
+	}
+	return nil, errors.Errorf("unknown shape %q", j.Name)
+}
+
+type jPathShape struct {
+	Path       string      `json:"path"`
+	ViewBox    string      `json:"viewBox"`
+	FillRule   string      `json:"fillRule"`
+	Label      *[2]float64 `json:"label"`
+	LabelScale float64     `json:"labelScale"`
+	Anchor     *[2]float64 `json:"anchor"`
+}
+
+func (j *jPathShape) decode() (icon.Drawable, error) {
+	p := icon.Path{
+		Data:       j.Path,
+		Label:      j.Label,
+		LabelScale: j.LabelScale,
+		Anchor:     j.Anchor,
+	}
+
+	vb := strings.FieldsFunc(j.ViewBox, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(vb) != 4 {
+		return nil, errors.Errorf("invalid viewBox %q", j.ViewBox)
+	}
+	for i, v := range vb {
+		var err error
+		p.ViewBox[i], err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid viewBox %q", j.ViewBox)
+		}
+	}
+
+	switch j.FillRule {
+	case "", "nonzero":
+	case "evenodd":
+		p.EvenOdd = true
+	default:
+		return nil, errors.Errorf("invalid fillRule %q", j.FillRule)
+	}
+
+	if j.LabelScale < 0 {
+		return nil, errors.New("invalid labelScale")
+	}
+
+	return icon.NewPathShape(p)
+}
+
+type jImageShape struct {
+	Image string `json:"image"`
+	Tint  string `json:"tint"`
+
+	sum [sha256.Size]byte // hash of the image data set by decode
+}
+
+func (j *jImageShape) decode(readImage ImageSource) (icon.Drawable, error) {
+	var tint icon.Tint
+	switch j.Tint {
+	case "", "none":
+		tint = icon.TintNone
+	case "multiply":
+		tint = icon.TintMultiply
+	case "mask":
+		tint = icon.TintMask
+	default:
+		return nil, errors.Errorf("invalid tint %q", j.Tint)
+	}
+
+	if !validImageFileName(j.Image) {
+		return nil, errors.Errorf("invalid image name %q", j.Image)
+	}
+	im, sum, err := loadImage(j.Image, readImage)
+	if err != nil {
+		return nil, err
+	}
+	j.sum = sum
+	return icon.NewImageShape(im, tint), nil
 }
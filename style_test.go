@@ -0,0 +1,760 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tajtiattila/beermap/icon"
+)
+
+func newTestStyler(t *testing.T, src string) *Styler {
+	t.Helper()
+	st, err := NewStyler(strings.NewReader(src), fontDir("res"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestPubBadges(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"styles": [
+			{"cond": "#closed", "badge": {"mark": "cross", "color": "red"}},
+			{"cond": "#hidden", "shape": "none"},
+			{"cond": "#hotel", "badge": {"mark": "letter", "letter": "H", "color": "navy", "corner": "bottomLeft"}},
+			{"cond": "#food", "badge": {"mark": "dot", "color": "orange"}},
+			{"shape": "circle", "color": "green"}
+		]
+	}`)
+
+	tests := []struct {
+		tags    string
+		visible bool
+		marks   []icon.BadgeMark
+	}{
+		{"", true, nil},
+		{"#closed", true, []icon.BadgeMark{icon.CrossMark}},
+		{"#hotel #closed", true, []icon.BadgeMark{icon.CrossMark, icon.LetterMark}},
+		{"#food #hotel", true, []icon.BadgeMark{icon.LetterMark, icon.DotMark}},
+		{"#closed #hidden", false, []icon.BadgeMark{icon.CrossMark}},
+	}
+
+	for _, x := range tests {
+		p := Pub{Tags: strings.Fields(x.tags)}
+		if got := st.Visible(p); got != x.visible {
+			t.Errorf("%q visible got %v, want %v", x.tags, got, x.visible)
+		}
+		var marks []icon.BadgeMark
+		for _, b := range st.pubBadges(p) {
+			marks = append(marks, b.Mark)
+		}
+		if len(marks) != len(x.marks) {
+			t.Errorf("%q badges got %v, want %v", x.tags, marks, x.marks)
+			continue
+		}
+		for i := range marks {
+			if marks[i] != x.marks[i] {
+				t.Errorf("%q badges got %v, want %v", x.tags, marks, x.marks)
+				break
+			}
+		}
+	}
+}
+
+func TestBadgeOnlyMatch(t *testing.T) {
+	for _, mode := range []string{"", "cascade"} {
+		st := newTestStyler(t, `{
+			"font": "Roboto-Medium.ttf",
+			"mode": "`+mode+`",
+			"styles": [
+				{"cond": "#closed", "badge": {"mark": "cross", "color": "red"}},
+				{"cond": "#hotel", "shape": "circle", "color": "green"}
+			]
+		}`)
+
+		p := Pub{Label: "1", Tags: []string{"#closed"}}
+		if !st.Visible(p) {
+			t.Errorf("mode %q: pub matching only a badge is hidden", mode)
+		}
+		job := st.pubJob(p, 2)
+		if len(job.badges) != 1 || job.badges[0].Mark != icon.CrossMark {
+			t.Errorf("mode %q: got badges %v, want a cross", mode, job.badges)
+		}
+		if job.shape == nil {
+			t.Errorf("mode %q: pub matching only a badge has no shape", mode)
+		}
+	}
+}
+
+func TestBadgeErrors(t *testing.T) {
+	tests := []string{
+		`{"mark": "moon", "color": "red"}`,
+		`{"mark": "dot"}`,
+		`{"mark": "letter", "letter": "AB", "color": "red"}`,
+		`{"mark": "dot", "color": "red", "corner": "middle"}`,
+	}
+	for _, badge := range tests {
+		src := `{"font": "Roboto-Medium.ttf", "styles": [{"badge": ` + badge + `}]}`
+		_, err := NewStyler(strings.NewReader(src), fontDir("res"), nil)
+		if err == nil {
+			t.Errorf("%s: want error", badge)
+		}
+	}
+}
+
+func TestBadgeWithIconProps(t *testing.T) {
+	tests := []struct {
+		props string
+		want  string
+	}{
+		{`"shape": "circle"`, "shape"},
+		{`"color": "red"`, "color"},
+		{`"label": "{{.Label}}!"`, "label"},
+		{`"size": 40`, "size"},
+		{`"opacity": 0.5`, "opacity"},
+		{`"glow": {"color": "yellow", "radius": 3}`, "glow"},
+	}
+	for _, mode := range []string{"", "cascade"} {
+		for _, x := range tests {
+			src := `{"font": "Roboto-Medium.ttf", "mode": "` + mode + `", "styles": [
+				{"cond": "#closed", "badge": {"mark": "cross", "color": "red"}, ` + x.props + `},
+				{"shape": "circle", "color": "navy"}]}`
+			_, err := NewStyler(strings.NewReader(src), fontDir("res"), nil)
+			if err == nil || !strings.Contains(err.Error(), "badge can't be combined with "+x.want) {
+				t.Errorf("mode %q, %s: got error %v, want badge combined with %s", mode, x.props, err, x.want)
+			}
+		}
+	}
+}
+
+func TestCascadeStyle(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"mode": "cascade",
+		"styles": [
+			{"shape": "circle", "color": "blue"},
+			{"cond": "#visited", "color": "green", "text": "auto"},
+			{"cond": "#closed", "opacity": 0.4, "outline": "gray"},
+			{"cond": "#hotel", "shape": "square"},
+			{"cond": "#gone", "shape": "none"},
+			{"cond": "#visited", "ignore": true, "color": "red"}
+		]
+	}`)
+
+	blue, _ := decodeColor("blue")
+	green, _ := decodeColor("green")
+	gray, _ := decodeColor("gray")
+	white, _ := decodeColor("white")
+
+	tests := []struct {
+		tags    string
+		visible bool
+		shape   icon.Drawable
+		fill    color.Color
+		outline color.Color
+		text    color.Color
+		opacity float64
+	}{
+		{"", true, icon.Circle, blue, white, white, 1},
+		{"#visited", true, icon.Circle, green, white, nil, 1},
+		{"#closed #visited", true, icon.Circle, green, gray, nil, 0.4},
+		{"#hotel #closed", true, icon.Square, blue, gray, white, 0.4},
+		{"#gone #hotel", false, nil, blue, white, white, 1},
+	}
+
+	for _, x := range tests {
+		p := Pub{Tags: strings.Fields(x.tags)}
+		if got := st.Visible(p); got != x.visible {
+			t.Errorf("%q visible got %v, want %v", x.tags, got, x.visible)
+		}
+		s, ok := st.pubStyle(p)
+		if !ok {
+			t.Errorf("%q has no style", x.tags)
+			continue
+		}
+		if s.Shape != x.shape {
+			t.Errorf("%q shape got %v, want %v", x.tags, s.Shape, x.shape)
+		}
+		if !sameColor(s.Color, x.fill) || !sameColor(s.Outline, x.outline) || !sameColor(s.Text, x.text) {
+			t.Errorf("%q colors got %v %v %v, want %v %v %v", x.tags,
+				s.Color, s.Outline, s.Text, x.fill, x.outline, x.text)
+		}
+		if s.Opacity != x.opacity {
+			t.Errorf("%q opacity got %v, want %v", x.tags, s.Opacity, x.opacity)
+		}
+	}
+}
+
+func TestStyleColors(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"styles": [
+			{"cond": "#custom", "shape": "circle", "color": "navy",
+				"outline": "yellow", "text": "orange", "shadow": "#0004"},
+			{"cond": "#auto", "shape": "circle", "color": "yellow", "text": "auto"},
+			{"cond": "#drop", "shape": "circle", "color": "navy",
+				"dropShadow": {"color": "#0008", "radius": 2, "offset": [1, 2]}},
+			{"cond": "#both", "shape": "circle", "color": "navy", "shadow": "red",
+				"dropShadow": {"color": "#0008", "radius": 2, "offset": [1, 2]}},
+			{"shape": "circle", "color": "navy"}
+		]
+	}`)
+
+	navy, _ := decodeColor("navy")
+	yellow, _ := decodeColor("yellow")
+	orange, _ := decodeColor("orange")
+	red, _ := decodeColor("red")
+	shadow, _ := decodeColor("#0004")
+	def := icon.SimpleColors(navy)
+
+	tests := []struct {
+		tag  string
+		want icon.Colors
+	}{
+		{"", def},
+		{"#custom", icon.Colors{Outline: yellow, Fill: navy, Shadow: shadow, Text: orange}},
+		{"#auto", icon.Colors{Outline: def.Outline, Fill: yellow, Shadow: def.Shadow, Text: color.Black}},
+		{"#drop", icon.Colors{Outline: def.Outline, Fill: navy, Shadow: color.Transparent, Text: def.Text}},
+		{"#both", icon.Colors{Outline: def.Outline, Fill: navy, Shadow: red, Text: def.Text}},
+	}
+
+	for _, x := range tests {
+		p := Pub{Tags: strings.Fields(x.tag)}
+		got := st.pubJob(p, 2).colors
+		if !sameColor(got.Outline, x.want.Outline) || !sameColor(got.Fill, x.want.Fill) ||
+			!sameColor(got.Shadow, x.want.Shadow) || !sameColor(got.Text, x.want.Text) {
+			t.Errorf("%q colors got %v, want %v", x.tag, got, x.want)
+		}
+	}
+}
+
+func TestContrastColor(t *testing.T) {
+	tests := []struct {
+		c    string
+		want color.Color
+	}{
+		{"black", color.White},
+		{"navy", color.White},
+		{"red", color.White},
+		{"gray", color.White},
+		{"yellow", color.Black},
+		{"white", color.Black},
+		{"lime", color.Black},
+	}
+	for _, x := range tests {
+		c, err := decodeColor(x.c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := contrastColor(c); got != x.want {
+			t.Errorf("%s: got %v, want %v", x.c, got, x.want)
+		}
+	}
+}
+
+func TestShapeNames(t *testing.T) {
+	tests := []struct {
+		name string
+		want icon.Drawable
+	}{
+		{"circle", icon.Circle},
+		{"square", icon.Square},
+		{"roundedSquare", icon.RoundedSquare},
+		{"diamond", icon.Diamond},
+		{"hexagon", icon.Hexagon},
+		{"star", icon.Star},
+		{"triangle", icon.Triangle},
+		{"pin", icon.Pin},
+		{"none", nil},
+	}
+	for _, x := range tests {
+		st := newTestStyler(t, `{"font": "Roboto-Medium.ttf",
+			"styles": [{"shape": "`+x.name+`", "color": "red"}]}`)
+		s, ok := st.pubStyle(Pub{Label: "1"})
+		if !ok || s.Shape != x.want {
+			t.Errorf("%s: got shape %v, want %v", x.name, s.Shape, x.want)
+		}
+	}
+
+	for _, name := range []string{"oval", "Circle", ""} {
+		src := `{"font": "Roboto-Medium.ttf", "styles": [{"shape": "` + name + `", "color": "red"}]}`
+		if _, err := NewStyler(strings.NewReader(src), fontDir("res"), nil); err == nil {
+			t.Errorf("shape %q: want error", name)
+		}
+	}
+}
+
+func TestPinAnchor(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"styles": [
+			{"cond": "#pin", "shape": "pin", "color": "navy"},
+			{"shape": "circle", "color": "navy"}
+		]
+	}`)
+
+	if _, _, ok := st.PubAnchor(Pub{Label: "1"}); ok {
+		t.Error("circle has an anchor, want bottom center")
+	}
+
+	p := Pub{Label: "1", Tags: []string{"#pin"}}
+	ax, ay, ok := st.PubAnchor(p)
+	if !ok {
+		t.Fatal("pin has no anchor")
+	}
+	r := st.r
+	if want := float64(r.Dim-r.Padding) / float64(r.Dim); ax != 0.5 || math.Abs(ay-want) > 1e-9 {
+		t.Errorf("got anchor %v,%v, want 0.5,%v", ax, ay, want)
+	}
+
+	size := st.PubIconSize(p)
+	for _, scale := range iconScales {
+		im := st.PubIconScale(p, scale)
+		dim := float64(size * scale)
+		x, y := int(ax*dim), int(ay*dim)-1
+		if _, _, _, a := im.At(x, y).RGBA(); a == 0 {
+			t.Errorf("at %dx: tip at %d,%d not covered", scale, x, y)
+		}
+		// nothing is drawn below the tip but the shadow
+		if c := color.NRGBAModel.Convert(im.At(x, y+scale+1)).(color.NRGBA); c.A > 0x80 {
+			t.Errorf("at %dx: got %v below the tip", scale, c)
+		}
+	}
+}
+
+func TestCascadeNoShape(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"mode": "cascade",
+		"styles": [{"cond": "#hotel", "color": "navy"}]
+	}`)
+	if _, ok := st.pubStyle(Pub{Tags: []string{"#hotel"}}); ok {
+		t.Error("style without shape accepted")
+	}
+}
+
+func sameColor(a, b color.Color) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return color.NRGBAModel.Convert(a) == color.NRGBAModel.Convert(b)
+}
+
+func TestImageShapeKey(t *testing.T) {
+	logo := func(c color.Color) []byte {
+		im := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		draw.Draw(im, im.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, im); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	var keys []string
+	for _, data := range [][]byte{logo(color.Black), logo(color.White)} {
+		var reads int
+		images := func(name string) ([]byte, error) {
+			reads++
+			return imageMap(map[string][]byte{"logo.png": data})(name)
+		}
+		st, err := NewStyler(strings.NewReader(`{
+			"font": "Roboto-Medium.ttf",
+			"styles": [{"shape": {"image": "logo.png"}}]
+		}`), fontDir("res"), images)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reads != 1 {
+			t.Errorf("image read %d times, want once", reads)
+		}
+		job := st.pubJob(Pub{Label: "1"}, 2)
+		if job.shapeKey == "" || !strings.Contains(job.shapeKey, "logo.png") {
+			t.Errorf("got shape key %q, want one naming the image", job.shapeKey)
+		}
+		keys = append(keys, job.shapeKey)
+	}
+	if keys[0] == keys[1] {
+		t.Errorf("images with different content have the same shape key %q", keys[0])
+	}
+}
+
+func TestPubIconSVG(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"svg": true,
+		"styles": [
+			{"cond": "#closed", "badge": {"mark": "cross", "color": "red"}},
+			{"cond": "#hotel", "shape": {"path": "M12 2c-4 0-7 3-7 7 0 5 7 13 7 13s7-8 7-13c0-4-3-7-7-7z", "viewBox": "0 0 24 24"},
+				"color": "navy", "size": 40},
+			{"shape": "star", "color": "orange", "opacity": 0.5,
+				"glow": {"color": "#ffffa0", "radius": 5}}
+		]
+	}`)
+
+	tests := []struct {
+		tags []string
+		size string
+	}{
+		// with the margin for the glow
+		{nil, "36"},
+		{[]string{"#closed"}, "36"},
+		{[]string{"#hotel", "#closed"}, "40"},
+	}
+	for _, x := range tests {
+		raw, err := st.PubIconSVG(Pub{Label: "12", Tags: x.tags})
+		if err != nil {
+			t.Fatalf("%q: %v", x.tags, err)
+		}
+
+		var doc struct {
+			XMLName xml.Name
+			Width   string `xml:"width,attr"`
+		}
+		if err := xml.Unmarshal(raw, &doc); err != nil {
+			t.Fatalf("%q: %v", x.tags, err)
+		}
+		if doc.XMLName.Local != "svg" || doc.Width != x.size {
+			t.Errorf("%q got <%s width=%q>, want <svg width=%q>", x.tags,
+				doc.XMLName.Local, doc.Width, x.size)
+		}
+	}
+}
+
+func TestIconSize(t *testing.T) {
+	tests := []struct {
+		global string
+		tag    string
+		want   int
+	}{
+		{"", "", defaultIconSize},
+		{"", "#big", 40},
+		{`"size": 32,`, "", 32},
+		{`"size": 32,`, "#big", 40},
+		{`"size": 32,`, "#closed #big", 32},
+	}
+	for _, x := range tests {
+		st := newTestStyler(t, `{
+			"font": "Roboto-Medium.ttf", `+x.global+`
+			"styles": [
+				{"cond": "#closed", "shape": "circle", "color": "gray"},
+				{"cond": "#big", "shape": "circle", "color": "red", "size": 40},
+				{"shape": "circle", "color": "navy"}
+			]
+		}`)
+		p := Pub{Label: "1", Tags: strings.Fields(x.tag)}
+		if got := st.PubIconSize(p); got != x.want {
+			t.Errorf("%s %q: got size %d, want %d", x.global, x.tag, got, x.want)
+		}
+		for _, scale := range iconScales {
+			b := st.PubIconScale(p, scale).Bounds()
+			if want := x.want * scale; b.Dx() != want || b.Dy() != want {
+				t.Errorf("%s %q at %dx: got image %v, want %d pixels", x.global, x.tag, scale, b, want)
+			}
+		}
+	}
+
+	for _, size := range []string{"-1", "129"} {
+		for _, src := range []string{
+			`{"font": "Roboto-Medium.ttf", "size": ` + size + `, "styles": [{"shape": "circle", "color": "red"}]}`,
+			`{"font": "Roboto-Medium.ttf", "styles": [{"shape": "circle", "color": "red", "size": ` + size + `}]}`,
+		} {
+			if _, err := NewStyler(strings.NewReader(src), fontDir("res"), nil); err == nil {
+				t.Errorf("%s: want error", src)
+			}
+		}
+	}
+}
+
+func TestEffectMarginSize(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"styles": [
+			{"cond": "#glow", "shape": "circle", "color": "navy",
+				"glow": {"color": "yellow", "radius": 16}},
+			{"cond": "#pin", "shape": "pin", "color": "navy", "size": 40,
+				"dropShadow": {"color": "#0008", "radius": 4, "offset": [2, 4]}},
+			{"shape": "circle", "color": "navy"}
+		]
+	}`)
+
+	tests := []struct {
+		tag    string
+		size   int
+		anchor bool
+	}{
+		{"", 28, false},
+		{"#glow", 28 + 2*9, true},
+		{"#pin", 40 + 2*7, true},
+	}
+	for _, x := range tests {
+		p := Pub{Label: "1", Tags: strings.Fields(x.tag)}
+		size := st.PubIconSize(p)
+		if size != x.size {
+			t.Errorf("%q: got size %d, want %d", x.tag, size, x.size)
+		}
+		for _, scale := range iconScales {
+			b := st.PubIconScale(p, scale).Bounds()
+			if b.Dx() != size*scale || b.Dy() != size*scale {
+				t.Errorf("%q at %dx: got image %v, want %d pixels", x.tag, scale, b, size*scale)
+			}
+		}
+
+		ax, ay, ok := st.PubAnchor(p)
+		if ok != x.anchor {
+			t.Errorf("%q: got anchor %v, want %v", x.tag, ok, x.anchor)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		// the anchor is at the bottom center of the shape, not in the margin,
+		// so the shape is just above it past the shadow
+		im := st.PubIconScale(p, 2)
+		px, py := int(ax*float64(size*2)), int(ay*float64(size*2))
+		if math.Abs(ax-0.5) > 0.01 {
+			t.Errorf("%q: got anchor x %v, want center", x.tag, ax)
+		}
+		var shape bool
+		for y := py - 1; y >= py-8; y-- {
+			if _, _, _, a := im.At(px, y).RGBA(); a == 0xffff {
+				shape = true
+				break
+			}
+		}
+		if !shape {
+			t.Errorf("%q: no shape above the anchor at %d,%d", x.tag, px, py)
+		}
+	}
+}
+
+func TestCascadeSpecificity(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"mode": "cascade",
+		"styles": [
+			{"shape": "circle", "color": "blue"},
+			{"cond": "#hotel and #closed", "color": "gray"},
+			{"cond": "#closed", "color": "red"},
+			{"cond": "#visited or (#new and #craft)", "color": "green"},
+			{"cond": "#craft", "color": "orange"}
+		]
+	}`)
+
+	tests := []struct {
+		tags string
+		fill string
+	}{
+		{"", "blue"},
+		{"#closed", "red"},
+		{"#hotel #closed", "gray"},
+		{"#craft", "orange"},
+		{"#new #craft", "green"},
+		{"#visited #craft", "green"},
+	}
+	for _, x := range tests {
+		s, ok := st.pubStyle(Pub{Tags: strings.Fields(x.tags)})
+		want, _ := decodeColor(x.fill)
+		if !ok || !sameColor(s.Color, want) {
+			t.Errorf("%q fill got %v, want %s", x.tags, s.Color, x.fill)
+		}
+	}
+}
+
+func TestCascadeImageColor(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	images := imageMap(map[string][]byte{"logo.png": buf.Bytes()})
+
+	for _, mode := range []string{"", "cascade"} {
+		st, err := NewStyler(strings.NewReader(`{
+			"font": "Roboto-Medium.ttf",
+			"mode": "`+mode+`",
+			"styles": [
+				{"cond": "#brewery", "shape": {"image": "logo.png", "tint": "multiply"}},
+				{"cond": "#pub", "shape": "circle", "color": "blue"}
+			]
+		}`), fontDir("res"), images)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, ok := st.pubStyle(Pub{Tags: []string{"#brewery"}})
+		if !ok || !sameColor(s.Color, color.White) {
+			t.Errorf("mode %q: image fill got %v, want white", mode, s.Color)
+		}
+	}
+}
+
+// svgNode is an element of an SVG document.
+type svgNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []svgNode  `xml:",any"`
+}
+
+func (n *svgNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// find returns the elements named name within n.
+func (n *svgNode) find(name string) []*svgNode {
+	var found []*svgNode
+	for i := range n.Nodes {
+		c := &n.Nodes[i]
+		if c.XMLName.Local == name {
+			found = append(found, c)
+		}
+		found = append(found, c.find(name)...)
+	}
+	return found
+}
+
+// pathBounds returns the bounds of the points of path data
+// having only commands with coordinate pairs, such as glyph outlines.
+func pathBounds(d string) (x0, y0, x1, y1 float64) {
+	f := strings.FieldsFunc(d, func(c rune) bool {
+		return c != '.' && c != '-' && (c < '0' || c > '9')
+	})
+	x0, y0, x1, y1 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for i := 0; i+1 < len(f); i += 2 {
+		x, _ := strconv.ParseFloat(f[i], 64)
+		y, _ := strconv.ParseFloat(f[i+1], 64)
+		x0, y0 = math.Min(x0, x), math.Min(y0, y)
+		x1, y1 = math.Max(x1, x), math.Max(y1, y)
+	}
+	return
+}
+
+// diffBounds returns the bounds of pixels different in a and b.
+func diffBounds(a, b image.Image) image.Rectangle {
+	var r image.Rectangle
+	bb := a.Bounds()
+	for y := bb.Min.Y; y < bb.Max.Y; y++ {
+		for x := bb.Min.X; x < bb.Max.X; x++ {
+			if !sameColor(a.At(x, y), b.At(x, y)) {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func TestPubIconSVGElements(t *testing.T) {
+	st := newTestStyler(t, `{
+		"font": "Roboto-Medium.ttf",
+		"svg": true,
+		"styles": [
+			{"cond": "#closed", "badge": {"mark": "cross", "color": "red", "corner": "bottomLeft"}},
+			{"shape": "square", "color": "navy", "glow": {"color": "yellow", "radius": 4}}
+		]
+	}`)
+	p := Pub{Label: "12", Tags: []string{"#closed"}}
+	raw, err := st.PubIconSVG(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc svgNode
+	if err := xml.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	job := st.pubJob(p, 2)
+	r := job.r
+	radius := float64(r.Dim)/2 - float64(r.Padding)
+
+	// effect filter
+	if len(doc.find("filter")) != 1 || len(doc.find("feGaussianBlur")) != 1 {
+		t.Error("missing effect filter")
+	}
+
+	// the shape and the badge are defined as paths
+	// scaled from the unit square by their radius
+	var shape, badge *svgNode
+	for _, n := range doc.find("path") {
+		switch tr := n.attr("transform"); {
+		case n.attr("id") == "":
+		case strings.HasSuffix(tr, fmt.Sprintf("scale(%v)", radius)):
+			shape = n
+		default:
+			badge = n
+		}
+	}
+	if shape == nil || badge == nil {
+		t.Fatalf("got shape %v, badge %v", shape, badge)
+	}
+
+	// shadow offset by the padding, and the outline stroke inset
+	var shadow, fill bool
+	for _, u := range doc.find("use") {
+		if u.attr("href") != "#"+shape.attr("id") {
+			continue
+		}
+		switch {
+		case u.attr("transform") == fmt.Sprintf("translate(0 %d)", r.Padding):
+			shadow = true
+		case u.attr("stroke-width") != "":
+			w, _ := strconv.ParseFloat(u.attr("stroke-width"), 64)
+			if want := 2 * float64(r.Stroke) / radius; math.Abs(w-want) > 1e-3 {
+				t.Errorf("got outline stroke width %v, want %v", w, want)
+			}
+			fill = true
+		}
+	}
+	if !shadow || !fill {
+		t.Errorf("got shadow %v, fill %v; want both", shadow, fill)
+	}
+
+	// label outline placed like the raster label
+	var label *svgNode
+	for _, n := range doc.find("path") {
+		if n.attr("id") == "" && n.attr("fill") == "#ffffff" {
+			label = n
+		}
+	}
+	if label == nil {
+		t.Fatal("missing label path")
+	}
+	noLabel := job
+	noLabel.label = ""
+	// raster bounds within the margin, like the view box of the document
+	margin := image.Pt(r.Margin, r.Margin)
+	lb := diffBounds(job.render(), noLabel.render()).Sub(margin)
+	x0, y0, x1, y1 := pathBounds(label.attr("d"))
+	if math.Abs(x0-float64(lb.Min.X)) > 1.5 || math.Abs(y0-float64(lb.Min.Y)) > 1.5 ||
+		math.Abs(x1-float64(lb.Max.X)) > 1.5 || math.Abs(y1-float64(lb.Max.Y)) > 1.5 {
+		t.Errorf("got label bounds %v %v %v %v, raster label at %v", x0, y0, x1, y1, lb)
+	}
+
+	// badge centered like the raster badge
+	var cx, cy, scale float64
+	tr := badge.attr("transform")
+	if _, err := fmt.Sscanf(tr, "translate(%g %g) scale(%g)", &cx, &cy, &scale); err != nil {
+		t.Fatalf("badge transform %q: %v", tr, err)
+	}
+	noBadge := job
+	noBadge.badges = nil
+	bb := diffBounds(job.render(), noBadge.render()).Sub(margin)
+	if math.Abs(cx-float64(bb.Min.X+bb.Max.X)/2) > 1.5 || math.Abs(cy-float64(bb.Min.Y+bb.Max.Y)/2) > 1.5 {
+		t.Errorf("got badge at %v,%v, raster badge at %v", cx, cy, bb)
+	}
+	if cx > float64(r.Dim)/2 || cy < float64(r.Dim)/2 {
+		t.Errorf("got badge at %v,%v, want bottom left", cx, cy)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"image/color"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// visitTagPrefix starts visit log tags such as "#visited:2019-05-03".
+const visitTagPrefix = "#visited:"
+
+const visitDateFormat = "2006-01-02"
+
+// parseVisits returns the dates of visit log entries in tags.
+func parseVisits(tags []string) ([]time.Time, error) {
+	var v []time.Time
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, visitTagPrefix) {
+			continue
+		}
+		t, err := time.Parse(visitDateFormat, strings.TrimPrefix(tag, visitTagPrefix))
+		if err != nil {
+			return nil, errors.Errorf("invalid visit date in %q", tag)
+		}
+		v = append(v, t)
+	}
+	return v, nil
+}
+
+// LastVisit returns the date of the last visit of p.
+func (p Pub) LastVisit() (time.Time, bool) {
+	var last time.Time
+	for _, t := range p.Visits {
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last, len(p.Visits) != 0
+}
+
+// period is a calendar period such as "2y", "6m", "3w" or "10d".
+type period struct {
+	years, months, days int
+}
+
+func parsePeriod(s string) (period, error) {
+	if len(s) < 2 {
+		return period{}, errors.Errorf("invalid period %q", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 0 {
+		return period{}, errors.Errorf("invalid period %q", s)
+	}
+	switch s[len(s)-1] {
+	case 'y':
+		return period{years: n}, nil
+	case 'm':
+		return period{months: n}, nil
+	case 'w':
+		return period{days: 7 * n}, nil
+	case 'd':
+		return period{days: n}, nil
+	}
+	return period{}, errors.Errorf("invalid period unit in %q", s)
+}
+
+// before returns the time d before t.
+func (d period) before(t time.Time) time.Time {
+	return t.AddDate(-d.years, -d.months, -d.days)
+}
+
+// lastVisitCond is Cond accepting pubs visited within a period
+type lastVisitCond struct {
+	within period
+	now    func() time.Time
+}
+
+func (c *lastVisitCond) Accept(p Pub) bool {
+	last, ok := p.LastVisit()
+	return ok && !last.Before(c.within.before(c.now()))
+}
+
+// visitCountCond is Cond comparing the number of visits
+type visitCountCond struct {
+	op string
+	n  int
+}
+
+func (c *visitCountCond) Accept(p Pub) bool {
+	v := len(p.Visits)
+	switch c.op {
+	case "<":
+		return v < c.n
+	case "<=":
+		return v <= c.n
+	case ">":
+		return v > c.n
+	case ">=":
+		return v >= c.n
+	}
+	return v == c.n
+}
+
+// decodeLastVisitCond decodes the rest of "last_visit within 2y".
+func decodeLastVisitCond(t *condTok) (Cond, error) {
+	if t.next() != "within" {
+		return nil, errors.New(`expected "within" after last_visit`)
+	}
+	d, err := parsePeriod(t.next())
+	if err != nil {
+		return nil, err
+	}
+	return &lastVisitCond{d, t.env.clock()}, nil
+}
+
+// decodeVisitCountCond decodes the rest of comparisons such as "visits>=3".
+// The operator and the number may be separate tokens.
+func decodeVisitCountCond(t *condTok, rest string) (Cond, error) {
+	if rest == "" {
+		rest = t.next()
+	}
+	op := strings.TrimRight(rest, "0123456789")
+	if op == rest {
+		// number is a separate token
+		rest += t.next()
+	}
+	switch op {
+	case "<", "<=", ">", ">=", "=", "==":
+	default:
+		return nil, errors.Errorf("invalid visits operator %q", op)
+	}
+	n, err := strconv.Atoi(rest[len(op):])
+	if err != nil || n < 0 {
+		return nil, errors.Errorf("invalid visit count %q", rest[len(op):])
+	}
+	return &visitCountCond{op, n}, nil
+}
+
+// recencyShade shades the fill color by the date of the last visit.
+type recencyShade struct {
+	Recent color.Color // fill for a visit today
+	Old    color.Color // fill for visits older than Age
+	Age    period
+}
+
+// color returns the fill for p at time now,
+// or def if p has no visits.
+func (r *recencyShade) color(p Pub, now time.Time, def color.Color) color.Color {
+	last, ok := p.LastVisit()
+	if !ok {
+		return def
+	}
+	span := now.Sub(r.Age.before(now))
+	if span <= 0 {
+		return r.Recent
+	}
+	f := float64(now.Sub(last)) / float64(span)
+	return lerpColor(r.Recent, r.Old, f)
+}
+
+type jRecency struct {
+	Recent string `json:"recent"`
+	Old    string `json:"old"`
+	Age    string `json:"age"`
+}
+
+func (j *jRecency) decode() (*recencyShade, error) {
+	var r recencyShade
+	var err error
+	if r.Recent, err = decodeColor(j.Recent); err != nil {
+		return nil, errors.Wrap(err, "recency")
+	}
+	if r.Old, err = decodeColor(j.Old); err != nil {
+		return nil, errors.Wrap(err, "recency")
+	}
+	if r.Age, err = parsePeriod(j.Age); err != nil {
+		return nil, errors.Wrap(err, "recency")
+	}
+	return &r, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestVisitCond(t *testing.T) {
+	mkpub := func(label string, tags ...string) Pub {
+		v, err := parseVisits(tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Pub{Label: label, Tags: tags, Visits: v}
+	}
+	pubs := []Pub{
+		mkpub("a", "#visited:2019-05-03"),
+		mkpub("b", "#visited:2015-01-01", "#visited:2016-02-02", "#visited:2016-03-03"),
+		mkpub("c", "#hotel"),
+	}
+
+	env, err := newCondEnv(nil, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.now = func() time.Time {
+		return time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"last_visit within 2y", "a"},
+		{"last_visit within 4y", "ab"},
+		{"last_visit within 6m", ""},
+		{"visits>=3", "b"},
+		{"visits >= 1", "ab"},
+		{"visits= 0", "c"},
+		{"visits<3 and not last_visit within 1y", "c"},
+	}
+
+	for _, x := range tests {
+		cond, err := decodeCondStringEnv(x.src, env)
+		if err != nil {
+			t.Fatalf("%s: %v", x.src, err)
+		}
+
+		var got string
+		for _, p := range pubs {
+			if cond.Accept(p) {
+				got += p.Label
+			}
+		}
+
+		if got != x.want {
+			t.Errorf("%s accept got %v, want %v", x.src, got, x.want)
+		}
+	}
+
+	for _, src := range []string{"last_visit 2y", "last_visit within 2x", "visits", "visits~3", "visits>=x"} {
+		if _, err := decodeCondStringEnv(src, env); err == nil {
+			t.Errorf("%s: want error", src)
+		}
+	}
+
+	if _, err := parseVisits([]string{"#visited:2019-13-01"}); err == nil {
+		t.Error("invalid visit date: want error")
+	}
+}
+
+func TestRecencyShade(t *testing.T) {
+	r := &recencyShade{
+		Recent: color.NRGBA{0, 200, 0, 255},
+		Old:    color.NRGBA{100, 100, 100, 255},
+		Age:    period{years: 2},
+	}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	def := color.NRGBA{0, 0, 255, 255}
+
+	tests := []struct {
+		visit string
+		want  color.NRGBA
+	}{
+		{"", def},
+		{"2020-01-01", color.NRGBA{0, 200, 0, 255}},
+		{"2019-01-01", color.NRGBA{50, 150, 50, 255}},
+		{"2010-01-01", color.NRGBA{100, 100, 100, 255}},
+	}
+
+	for _, x := range tests {
+		var p Pub
+		if x.visit != "" {
+			v, err := time.Parse(visitDateFormat, x.visit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Visits = []time.Time{v}
+		}
+		got := color.NRGBAModel.Convert(r.color(p, now, def)).(color.NRGBA)
+		if got != x.want {
+			t.Errorf("visit %q got %v, want %v", x.visit, got, x.want)
+		}
+	}
+}